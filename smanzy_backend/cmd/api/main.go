@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	// Gin is a web framework for Go (handling HTTP requests/responses)
 	"github.com/gin-gonic/gin"
@@ -17,10 +21,11 @@ import (
 	"github.com/ristep/smanzy_backend/internal/auth"
 	"github.com/ristep/smanzy_backend/internal/db"
 	"github.com/ristep/smanzy_backend/internal/handlers"
+	"github.com/ristep/smanzy_backend/internal/mailer"
 	"github.com/ristep/smanzy_backend/internal/middleware"
+	"github.com/ristep/smanzy_backend/internal/oidc"
 	"github.com/ristep/smanzy_backend/internal/services"
 	"github.com/ulule/limiter/v3"
-	mgin "github.com/ulule/limiter/v3/drivers/middleware/gin"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
 )
 
@@ -43,9 +48,14 @@ func main() {
 		log.Fatal("DB_DSN environment variable is required")
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET") // Secret key for signing JWT tokens
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
+	jwtSecret := os.Getenv("JWT_SECRET") // Secret key for signing JWT tokens (HS256)
+
+	// Asymmetric signing keys (RS256/EdDSA). When set, tokens are signed with
+	// a key from this directory and JWT_SECRET is only used to accept older
+	// HS256 tokens.
+	jwtKeyDir := os.Getenv("JWT_KEY_DIR")
+	if jwtSecret == "" && jwtKeyDir == "" {
+		log.Fatal("JWT_SECRET or JWT_KEY_DIR environment variable is required")
 	}
 
 	serverPort := os.Getenv("SERVER_PORT") // Port to run the server on
@@ -63,6 +73,54 @@ func main() {
 		log.Println("Warning: YOUTUBE_CHANNEL_ID not set, YouTube sync will not work")
 	}
 
+	// Frontend origin used in links sent by email
+	appBaseURL := os.Getenv("APP_BASE_URL")
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:5173"
+	}
+
+	// Days between a user asking for their account to be deleted and the deletion
+	deletionGracePeriod := envDays("ACCOUNT_DELETION_GRACE_DAYS", services.DefaultAccountDeletionGracePeriod)
+
+	// Days soft-deleted users, albums and media are kept before they are
+	// purged with their files (0 disables purging)
+	retentionPeriod := envDays("RETENTION_DAYS", services.DefaultRetentionPeriod)
+
+	// OpenID Connect sign-in (optional, enabled when OIDC_ISSUER_URL is set)
+	oidcIssuerURL := os.Getenv("OIDC_ISSUER_URL")
+	oidcProviderName := os.Getenv("OIDC_PROVIDER_NAME")
+	if oidcProviderName == "" {
+		oidcProviderName = "oidc"
+	}
+	if oidcIssuerURL != "" && (os.Getenv("OIDC_CLIENT_ID") == "" || os.Getenv("OIDC_REDIRECT_URL") == "") {
+		log.Fatal("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+	}
+
+	// Outgoing mail (MAILER=smtp|file|log)
+	mailService, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+
+	// Password hashing (PASSWORD_HASH_ALGORITHM=argon2id|bcrypt). Existing
+	// hashes are upgraded at login when these settings change.
+	passwordHasher, err := passwordHasherFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure password hashing: %v", err)
+	}
+
+	// Origins whose pages may call the API from a browser
+	corsPolicy, corsGroupPolicies, err := corsPoliciesFromEnv(appBaseURL)
+	if err != nil {
+		log.Fatalf("Failed to configure CORS: %v", err)
+	}
+
+	// Browser sessions in HttpOnly cookies (optional, AUTH_COOKIES=true)
+	sessionCookies, err := sessionCookiesFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure session cookies: %v", err)
+	}
+
 	// 3. Database Connection
 	// Connect to PostgreSQL using standard library
 	conn, err := db.Connect(dbDSN)
@@ -82,50 +140,116 @@ func main() {
 	log.Println("Database connection established")
 
 	// 5. Seeding Data
-	// Ensure that basic roles exist in the database
-	_, _ = conn.Exec("INSERT INTO roles (name) VALUES ('user') ON CONFLICT (name) DO NOTHING")
-	_, _ = conn.Exec("INSERT INTO roles (name) VALUES ('admin') ON CONFLICT (name) DO NOTHING")
+	// Ensure that the built-in roles and their permissions exist in the database
+	if err := services.SeedRBAC(context.Background(), queries); err != nil {
+		log.Fatalf("Failed to seed roles and permissions: %v", err)
+	}
 
 	// 6. Service Initialization
 	// Initialize our services and handlers, injecting dependencies (like the DB connection)
 	jwtService := auth.NewJWTService(jwtSecret)
-	youtubeService := services.NewYouTubeService(youtubeAPIKey, youtubeChannelID)
+	if jwtKeyDir != "" {
+		keySet, err := auth.LoadKeySet(jwtKeyDir, os.Getenv("JWT_SIGNING_KID"))
+		if err != nil {
+			log.Fatalf("Failed to load JWT keys: %v", err)
+		}
+		jwtService = auth.NewJWTServiceWithKeys(keySet, jwtSecret)
+		log.Printf("Signing JWTs with key %q (%s)", keySet.SigningKey().ID, keySet.SigningKey().Method.Alg())
+	}
+
+	// Counters of security limits, such as two-factor attempts and password
+	// reset and verification emails, always live in Postgres so the limits
+	// hold across replicas
+	securityLimitStore := services.NewPostgresRateLimitStore(queries)
+	go securityLimitStore.Run(context.Background(), 10*time.Minute)
 
-	authHandler := handlers.NewAuthHandler(conn, queries, jwtService)
-	userHandler := handlers.NewUserHandler(conn, queries)
+	youtubeService := services.NewYouTubeService(youtubeAPIKey, youtubeChannelID)
+	sessionService := services.NewSessionService(conn, queries, jwtService)
+	verificationService := services.NewEmailVerificationService(queries, jwtService, mailService, appBaseURL, securityLimitStore)
+	resetService := services.NewPasswordResetService(conn, queries, mailService, appBaseURL, sessionService, passwordHasher, securityLimitStore)
+	twoFactorService := services.NewTwoFactorService(conn, queries, securityLimitStore)
+	apiKeyService := services.NewAPIKeyService(conn, queries)
+	loginThrottle := services.NewLoginThrottleService(conn, queries)
+	roleService := services.NewRoleService(conn, queries)
+	invitationService := services.NewInvitationService(queries)
+	auditService := services.NewAuditService(queries)
+	accountDeletion := services.NewAccountDeletionService(conn, queries, sessionService, deletionGracePeriod)
+	dataExport := services.NewDataExportService(queries, os.Getenv("UPLOAD_DIR"))
+	retentionService := services.NewRetentionService(conn, queries, os.Getenv("UPLOAD_DIR"), retentionPeriod)
+
+	authHandler := handlers.NewAuthHandler(conn, queries, jwtService, sessionService, verificationService, resetService, twoFactorService, loginThrottle, accountDeletion, dataExport, passwordHasher, sessionCookies)
+	impersonationService := services.NewImpersonationService(queries, jwtService)
+	userCSVService := services.NewUserCSVService(conn, queries, resetService)
+	userHandler := handlers.NewUserHandler(conn, queries, sessionService, loginThrottle, impersonationService, passwordHasher, userCSVService)
 	mediaHandler := handlers.NewMediaHandler(conn, queries)
 	albumHandler := handlers.NewAlbumHandler(conn, queries)
 	videoHandler := handlers.NewVideoHandler(conn, queries, youtubeService)
 	settingsHandler := handlers.NewSettingsHandler(conn, queries)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	roleHandler := handlers.NewRoleHandler(roleService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+
+	var oidcHandler *handlers.OIDCHandler
+	if oidcIssuerURL != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			IssuerURL:    oidcIssuerURL,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+		})
+		oidcService := services.NewOIDCService(conn, queries, provider, oidcProviderName)
+		oidcHandler = handlers.NewOIDCHandler(jwtService, oidcService, sessionService, twoFactorService, sessionCookies, appBaseURL)
+		log.Printf("OIDC sign-in enabled (%s)", oidcIssuerURL)
+	}
+
+	// Delete expired tokens, old sessions and old login attempts
+	go sessionService.Run(context.Background(), time.Hour)
+	go loginThrottle.Run(context.Background(), time.Hour)
+
+	// Soft delete accounts whose deletion grace period has ended
+	go accountDeletion.Run(context.Background(), time.Hour)
+
+	// Purge rows (and their files) that were soft deleted before the retention window
+	if retentionPeriod > 0 {
+		go retentionService.Run(context.Background(), time.Hour)
+	} else {
+		log.Println("RETENTION_DAYS is 0, soft-deleted data is kept forever")
+	}
 
 	// 7. Router Setup
 	// Create a new Gin router with default middleware (logger and recovery)
 	router := gin.Default()
 
-	// Custom handler for rate limit errors
-	router.Use(func(c *gin.Context) {
-		c.Next()
-		if c.Writer.Status() == http.StatusTooManyRequests {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded. Try again later."})
-		}
-	})
+	// Only trust X-Forwarded-For from known proxies, otherwise clients can
+	// choose the IP that login throttling and rate limits see. Gin trusts
+	// every proxy by default, so without TRUSTED_PROXIES none are trusted.
+	var trustedProxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trustedProxies = strings.Split(v, ",")
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Apply CORS middleware (Cross-Origin Resource Sharing) to allow frontend to talk to backend
-	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.CORSMiddleware(corsPolicy, corsGroupPolicies))
 
 	// Health check endpoint - useful for monitoring if the app is up
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	// Initialize rate limiter (e.g., 5 requests per minute per IP)
-	rate := limiter.Rate{
-		Period: time.Minute,
-		Limit:  15, // Adjust this value as needed
-	}
-	store := memory.NewStore() // Use in-memory for dev; switch to Redis for production
-	limiterInstance := limiter.New(store, rate)
-	rateLimitMiddleware := mgin.NewMiddleware(limiterInstance)
+	// Public keys for verifying our JWTs (empty when signing with HS256)
+	router.GET("/.well-known/jwks.json", authHandler.JWKSHandler)
+
+	// Rate limiting (RATE_LIMIT_STORE=memory|postgres). Each policy counts
+	// per user when authenticated, per IP otherwise.
+	rateLimitStore := rateLimitStoreFromEnv(securityLimitStore)
+	authRateLimit := rateLimitPolicy(rateLimitStore, "auth", "15-M")
+	apiRateLimit := rateLimitPolicy(rateLimitStore, "api", "600-M")
+	uploadRateLimit := rateLimitPolicy(rateLimitStore, "upload", "60-H")
 
 	// 8. Define Routes
 	// Group routes under /api
@@ -139,11 +263,27 @@ func main() {
 		api.GET("/version", versionHandler.GetVersionHandler)
 
 		auth := api.Group("/auth")
-		auth.Use(rateLimitMiddleware) // Apply rate limiting here
+		auth.Use(authRateLimit) // Per IP, these routes are unauthenticated
 		{
 			auth.POST("/register", authHandler.RegisterHandler)
 			auth.POST("/login", authHandler.LoginHandler)
 			auth.POST("/refresh", authHandler.RefreshHandler)
+			auth.POST("/verify-email", authHandler.VerifyEmailHandler)
+			auth.POST("/resend-verification", authHandler.ResendVerificationHandler)
+			auth.POST("/forgot-password", authHandler.ForgotPasswordHandler)
+			auth.POST("/reset-password", authHandler.ResetPasswordHandler)
+			auth.POST("/2fa/verify", authHandler.VerifyTwoFactorHandler) // Exchange a login challenge + code for tokens
+
+			// CSRF token of a cookie-mode session
+			if sessionCookies != nil {
+				auth.GET("/csrf", authHandler.CSRFTokenHandler)
+			}
+
+			// OpenID Connect sign-in (browser redirects)
+			if oidcHandler != nil {
+				auth.GET("/oidc/login", oidcHandler.LoginHandler)
+				auth.GET("/oidc/callback", oidcHandler.CallbackHandler)
+			}
 		}
 
 		// Public video endpoints
@@ -179,81 +319,160 @@ func main() {
 	}
 
 	// == PROTECTED ROUTES ==
-	// Requires a valid JWT token in the Authorization header
+	// Requires a valid JWT token in the Authorization header. Personal API
+	// keys are accepted only on routes with a RequireScope middleware.
 	protectedAPI := router.Group("/api")
 	// Apply the AuthMiddleware to check for the token
-	protectedAPI.Use(middleware.AuthMiddleware(jwtService, queries))
+	protectedAPI.Use(middleware.AuthMiddleware(jwtService, queries), apiRateLimit)
 	{
+		// Account security actions stay with the account owner, never an impersonating admin
+		noImpersonation := middleware.DenyImpersonation()
+
+		// Session termination
+		protectedAPI.POST("/auth/logout", authHandler.LogoutHandler)                         // End the current session
+		protectedAPI.POST("/auth/logout-all", noImpersonation, authHandler.LogoutAllHandler) // End every session of the current user
+
 		// Authenticated User routes
 		profile := protectedAPI.Group("/profile")
 		{
-			profile.GET("", authHandler.ProfileHandler)       // Get current user profile
-			profile.PUT("", authHandler.UpdateProfileHandler) // Update current user profile
+			profile.GET("", authHandler.ProfileHandler)                                  // Get current user profile
+			profile.PUT("", authHandler.UpdateProfileHandler)                            // Update current user profile
+			profile.PUT("/password", noImpersonation, authHandler.ChangePasswordHandler) // Change password (requires the current one)
+			profile.DELETE("", noImpersonation, authHandler.DeleteProfileHandler)        // Schedule account deletion (requires the password)
+			profile.GET("/export", noImpersonation, authHandler.ExportProfileHandler)    // Download a ZIP of the user's data
+
+			// Two-factor authentication (TOTP)
+			profile.GET("/2fa", authHandler.TwoFactorStatusHandler)
+			profile.POST("/2fa", noImpersonation, authHandler.EnrollTwoFactorHandler)          // Start enrollment (returns URI + recovery codes)
+			profile.POST("/2fa/confirm", noImpersonation, authHandler.ConfirmTwoFactorHandler) // Enable with a code from the app
+			profile.DELETE("/2fa", noImpersonation, authHandler.DisableTwoFactorHandler)       // Disable (requires password + code)
+
+			// Sessions (devices) the user is logged in on
+			profile.GET("/sessions", authHandler.ListSessionsHandler)
+			profile.DELETE("/sessions/:id", noImpersonation, authHandler.RevokeSessionHandler)
+
+			// Personal API keys for scripts and CI
+			profile.GET("/api-keys", apiKeyHandler.ListAPIKeysHandler)
+			profile.POST("/api-keys", noImpersonation, apiKeyHandler.CreateAPIKeyHandler) // Returns the key once
+			profile.DELETE("/api-keys/:id", noImpersonation, apiKeyHandler.RevokeAPIKeyHandler)
 		}
 
-		// Admin-only routes
-		// Apply RoleMiddleware to check if the user has "admin" role
+		// Requests through these are recorded in the audit log
+		auditUser := func(action string) gin.HandlerFunc {
+			return middleware.Audit(auditService, action, services.AuditTargetUser)
+		}
+		auditMediaDelete := middleware.Audit(auditService, services.AuditMediaDelete, services.AuditTargetMedia)
+		auditAlbumDelete := middleware.Audit(auditService, services.AuditAlbumDelete, services.AuditTargetAlbum)
+		auditRole := func(action string) gin.HandlerFunc {
+			return middleware.Audit(auditService, action, services.AuditTargetRole)
+		}
+		auditInvitation := func(action string) gin.HandlerFunc {
+			return middleware.Audit(auditService, action, services.AuditTargetInvitation)
+		}
+
+		// User management routes
+		// Apply RequirePermission to check the user's role permissions, and
+		// AdminTwoFactorMiddleware to enforce the require-admin-2fa setting.
+		// Everything but plain reads is audited.
+		canWriteUsers := middleware.RequirePermission(auth.PermUsersWrite)
 		users := protectedAPI.Group("/users")
-		users.Use(middleware.RoleMiddleware("admin"))
+		users.Use(middleware.RequirePermission(auth.PermUsersRead), middleware.AdminTwoFactorMiddleware(queries))
 		{
-			users.GET("", userHandler.GetAllUsersHandler)
-			users.GET("/deleted", userHandler.GetAllUsersWithDeletedHandler)
+			users.GET("", userHandler.ListUsersHandler) // ?q=&role=&state=active|deleted|all&sort=-created_at&page=&limit=
 			users.GET("/:id", userHandler.GetUserByIDHandler)
-			users.PUT("/:id", userHandler.UpdateUserHandler)
-			users.DELETE("/:id", userHandler.DeleteUserHandler)
-			users.POST("/:id/restore", userHandler.RestoreUserHandler)
+			users.GET("/:id/login-history", userHandler.LoginHistoryHandler) // Includes impersonations
+
+			// Bulk import and export as CSV
+			users.GET("/export", auditUser(services.AuditUserExport), userHandler.ExportUsersHandler)                 // Same filters as the listing
+			users.POST("/import", canWriteUsers, auditUser(services.AuditUserImport), userHandler.ImportUsersHandler) // ?dry_run=true&notify=none|invite
+
+			users.PUT("/:id", canWriteUsers, auditUser(services.AuditUserUpdate), userHandler.UpdateUserHandler)
+			users.DELETE("/:id", canWriteUsers, auditUser(services.AuditUserDelete), userHandler.DeleteUserHandler)
+			users.POST("/:id/restore", canWriteUsers, auditUser(services.AuditUserRestore), userHandler.RestoreUserHandler)
+			users.POST("/:id/logout", canWriteUsers, auditUser(services.AuditUserLogout), userHandler.ForceLogoutHandler) // Revoke every session of the user
+			users.POST("/:id/unlock", canWriteUsers, auditUser(services.AuditUserUnlock), userHandler.UnlockUserHandler)  // Lift a login lockout
+			users.POST("/:id/impersonate", middleware.RequirePermission(auth.PermUsersImpersonate), noImpersonation, auditUser(services.AuditUserImpersonate), userHandler.ImpersonateHandler)
 
 			// Password management
-			users.PUT("/:id/password", userHandler.ResetUserPasswordHandler)
+			users.PUT("/:id/password", canWriteUsers, noImpersonation, auditUser(services.AuditUserPasswordReset), userHandler.ResetUserPasswordHandler)
 
 			// Role management
-			users.POST("/:id/roles", userHandler.AssignRoleHandler)
-			users.DELETE("/:id/roles", userHandler.RemoveRoleHandler)
+			users.POST("/:id/roles", middleware.RequirePermission(auth.PermRolesAssign), noImpersonation, auditUser(services.AuditUserRoleAssign), userHandler.AssignRoleHandler)
+			users.DELETE("/:id/roles", middleware.RequirePermission(auth.PermRolesAssign), noImpersonation, auditUser(services.AuditUserRoleRemove), userHandler.RemoveRoleHandler)
+		}
+
+		// Role management routes
+		roles := protectedAPI.Group("/roles")
+		roles.Use(middleware.RequirePermission(auth.PermRolesManage), middleware.AdminTwoFactorMiddleware(queries))
+		{
+			roles.GET("", roleHandler.ListRolesHandler) // With permissions and member counts
+			roles.POST("", auditRole(services.AuditRoleCreate), roleHandler.CreateRoleHandler)
+			roles.GET("/:id", roleHandler.GetRoleHandler)
+			roles.PUT("/:id", auditRole(services.AuditRoleUpdate), roleHandler.UpdateRoleHandler)    // Rename and/or replace permissions
+			roles.DELETE("/:id", auditRole(services.AuditRoleDelete), roleHandler.DeleteRoleHandler) // ?cascade=true removes it from its members
+			roles.GET("/:id/users", roleHandler.ListRoleUsersHandler)
+		}
+
+		// Invitation codes for invite-only registration
+		invitations := protectedAPI.Group("/invitations")
+		invitations.Use(middleware.RequirePermission(auth.PermInvitesManage), middleware.AdminTwoFactorMiddleware(queries))
+		{
+			invitations.GET("", invitationHandler.ListInvitationsHandler)
+			invitations.POST("", auditInvitation(services.AuditInvitationCreate), invitationHandler.CreateInvitationHandler) // Returns the code once; granting a role also needs roles:assign
+			invitations.DELETE("/:id", auditInvitation(services.AuditInvitationDelete), invitationHandler.DeleteInvitationHandler)
 		}
 
 		// Media routes (authenticated)
 		media := protectedAPI.Group("/media")
 		{
-			media.POST("", mediaHandler.UploadHandler)                        // Upload a new file
-			media.GET("/:id", mediaHandler.GetMediaHandler)                   // Get file content
-			media.GET("/:id/details", mediaHandler.GetMediaDetailsHandler)    // Get file metadata
-			media.GET("/album/:album_id", mediaHandler.ListAlbumMediaHandler) // List media for an album
-			media.PUT("/:id", mediaHandler.UpdateMediaHandler)                // Edit file (Owner or Admin)
-			media.DELETE("/:id", mediaHandler.DeleteMediaHandler)             // Delete file (Owner or Admin)
+			// Upload a new file
+			media.POST("", uploadRateLimit, middleware.RequireScope(auth.ScopeMediaWrite), middleware.RequirePermission(auth.PermMediaUpload), middleware.VerifiedEmailMiddleware(queries), mediaHandler.UploadHandler)
+			media.GET("/:id", mediaHandler.GetMediaHandler)                         // Get file content
+			media.GET("/:id/details", mediaHandler.GetMediaDetailsHandler)          // Get file metadata
+			media.GET("/album/:album_id", mediaHandler.ListAlbumMediaHandler)       // List media for an album
+			media.PUT("/:id", mediaHandler.UpdateMediaHandler)                      // Edit file (Owner or media:write:any)
+			media.DELETE("/:id", auditMediaDelete, mediaHandler.DeleteMediaHandler) // Delete file (Owner or media:delete:any)
 		}
 
 		// Album routes (authenticated)
 		albums := protectedAPI.Group("/albums")
 		{
-			albums.POST("", albumHandler.CreateAlbumHandler)       // Create a new album
-			albums.GET("", albumHandler.GetUserAlbumsHandler)      // Get all albums for current user
-			albums.GET("/:id", albumHandler.GetAlbumHandler)       // Get album by ID
-			albums.PUT("/:id", albumHandler.UpdateAlbumHandler)    // Update album details
-			albums.DELETE("/:id", albumHandler.DeleteAlbumHandler) // Delete album (soft delete)
+			albums.POST("", albumHandler.CreateAlbumHandler)                         // Create a new album
+			albums.GET("", albumHandler.GetUserAlbumsHandler)                        // Get all albums for current user
+			albums.GET("/:id", albumHandler.GetAlbumHandler)                         // Get album by ID
+			albums.PUT("/:id", albumHandler.UpdateAlbumHandler)                      // Update album details
+			albums.DELETE("/:id", auditAlbumDelete, albumHandler.DeleteAlbumHandler) // Delete album (soft delete)
 
 			// Album media management
 			albums.POST("/:id/media", albumHandler.AddMediaToAlbumHandler)        // Add media to album
 			albums.DELETE("/:id/media", albumHandler.RemoveMediaFromAlbumHandler) // Remove media from album
 		}
 
-		// Admin-only album routes
+		// Album routes across users
 		adminAlbums := protectedAPI.Group("/albums")
-		adminAlbums.Use(middleware.RoleMiddleware("admin"))
+		adminAlbums.Use(middleware.RequirePermission(auth.PermAlbumsReadAny), middleware.AdminTwoFactorMiddleware(queries))
 		{
-			adminAlbums.GET("/all", albumHandler.GetAllAlbumsHandler) // Get all albums from all users (admin only)
+			adminAlbums.GET("/all", albumHandler.GetAllAlbumsHandler) // Get all albums from all users
 		}
 
 		// Video routes (authenticated)
 		videos := protectedAPI.Group("/videos")
 		{
-			videos.POST("/sync", videoHandler.SyncVideosHandler) // Sync videos from YouTube
+			videos.POST("/sync", middleware.RequireScope(auth.ScopeVideosSync), middleware.RequirePermission(auth.PermVideosSync), videoHandler.SyncVideosHandler) // Sync videos from YouTube
 		}
 
-		// Settings management (admin only)
+		// Settings management
 		settings := protectedAPI.Group("/settings")
-		settings.Use(middleware.RoleMiddleware("admin"))
+		settings.Use(middleware.RequirePermission(auth.PermSettingsWrite), middleware.AdminTwoFactorMiddleware(queries))
+		{
+			settings.PUT("/:key", middleware.Audit(auditService, services.AuditSettingUpdate, services.AuditTargetSetting), settingsHandler.UpdateSettingHandler)
+		}
+
+		// Audit log of privileged actions
+		admin := protectedAPI.Group("/admin")
+		admin.Use(middleware.RequirePermission(auth.PermAuditRead), middleware.AdminTwoFactorMiddleware(queries))
 		{
-			settings.PUT("/:key", settingsHandler.UpdateSettingHandler)
+			admin.GET("/audit", auditHandler.ListAuditLogHandler) // ?actor_id=&action=&target_type=&target_id=&since=&until=&page=&limit=
 		}
 
 	}
@@ -265,3 +484,156 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// envDays reads a whole number of days from the environment, or returns def
+// when the variable is not set
+func envDays(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		log.Fatalf("Invalid %s %q, expected a number of days", name, v)
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// envInt reads a non-negative integer environment variable, returning def when it is unset
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s %q, expected a non-negative number", name, v)
+	}
+	return n
+}
+
+// corsPoliciesFromEnv builds the CORS policies from CORS_ALLOWED_ORIGINS
+// (comma-separated, defaulting to the origin of APP_BASE_URL), CORS_ADMIN_ORIGINS
+// and CORS_MAX_AGE. It returns the default policy and the per-path overrides:
+// the JWKS is public, and the admin routes can be limited to fewer origins.
+func corsPoliciesFromEnv(appBaseURL string) (*middleware.CORSPolicy, map[string]*middleware.CORSPolicy, error) {
+	maxAge := time.Duration(envInt("CORS_MAX_AGE", 600)) * time.Second
+
+	origins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if origins == "" {
+		base, err := url.Parse(appBaseURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid APP_BASE_URL: %w", err)
+		}
+		origins = base.Scheme + "://" + base.Host
+	}
+	policy, err := middleware.NewCORSPolicy(strings.Split(origins, ","), true, maxAge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CORS_ALLOWED_ORIGINS: %w", err)
+	}
+
+	publicPolicy, err := middleware.NewCORSPolicy([]string{"*"}, false, maxAge)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := map[string]*middleware.CORSPolicy{
+		"/.well-known/": publicPolicy,
+	}
+
+	if adminOrigins := os.Getenv("CORS_ADMIN_ORIGINS"); adminOrigins != "" {
+		adminPolicy, err := middleware.NewCORSPolicy(strings.Split(adminOrigins, ","), true, maxAge)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CORS_ADMIN_ORIGINS: %w", err)
+		}
+		for _, prefix := range []string{"/api/admin", "/api/users", "/api/roles", "/api/invitations"} {
+			groups[prefix] = adminPolicy
+		}
+	}
+
+	return policy, groups, nil
+}
+
+// rateLimitStoreFromEnv returns the store rate limit counters are kept in:
+// process memory by default, or the given Postgres store with
+// RATE_LIMIT_STORE=postgres so that all replicas share them
+func rateLimitStoreFromEnv(postgresStore *services.PostgresRateLimitStore) limiter.Store {
+	switch kind := os.Getenv("RATE_LIMIT_STORE"); kind {
+	case "", "memory":
+		return memory.NewStore()
+	case "postgres":
+		return postgresStore
+	default:
+		log.Fatalf("Invalid RATE_LIMIT_STORE %q, expected memory or postgres", kind)
+		return nil
+	}
+}
+
+// rateLimitPolicy builds the rate limit middleware of a policy. The limit is
+// read from RATE_LIMIT_<NAME> in the "<limit>-<S|M|H|D>" format (e.g. 15-M
+// for 15 requests a minute), falling back to def; "off" disables the policy.
+func rateLimitPolicy(store limiter.Store, name, def string) gin.HandlerFunc {
+	envName := "RATE_LIMIT_" + strings.ToUpper(name)
+	formatted := os.Getenv(envName)
+	if formatted == "" {
+		formatted = def
+	}
+	if formatted == "off" {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	rate, err := limiter.NewRateFromFormatted(formatted)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", envName, formatted, err)
+	}
+	return middleware.RateLimit(name, limiter.New(store, rate))
+}
+
+// sessionCookiesFromEnv builds the session cookie settings from AUTH_COOKIES,
+// AUTH_COOKIE_SECURE, AUTH_COOKIE_SAMESITE and AUTH_COOKIE_DOMAIN. It returns
+// nil when cookie mode is off.
+func sessionCookiesFromEnv() (*auth.SessionCookies, error) {
+	if os.Getenv("AUTH_COOKIES") != "true" {
+		return nil, nil
+	}
+
+	cookies := &auth.SessionCookies{
+		Secure:   os.Getenv("AUTH_COOKIE_SECURE") != "false",
+		SameSite: http.SameSiteLaxMode,
+		Domain:   os.Getenv("AUTH_COOKIE_DOMAIN"),
+	}
+	if v := os.Getenv("AUTH_COOKIE_SAMESITE"); v != "" {
+		sameSite, err := auth.ParseSameSite(v)
+		if err != nil {
+			return nil, err
+		}
+		cookies.SameSite = sameSite
+	}
+
+	// Browsers drop SameSite=None cookies that are not Secure
+	if cookies.SameSite == http.SameSiteNoneMode && !cookies.Secure {
+		return nil, fmt.Errorf("AUTH_COOKIE_SAMESITE=none requires AUTH_COOKIE_SECURE=true")
+	}
+	return cookies, nil
+}
+
+// passwordHasherFromEnv builds the password hasher from PASSWORD_HASH_ALGORITHM,
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS, ARGON2_PARALLELISM and BCRYPT_COST
+func passwordHasherFromEnv() (*auth.PasswordHasher, error) {
+	algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM")
+	if algorithm == "" {
+		algorithm = auth.HashArgon2id
+	}
+
+	params := auth.DefaultArgon2Params
+	params.Memory = uint32(envInt("ARGON2_MEMORY_KIB", int(params.Memory)))
+	params.Iterations = uint32(envInt("ARGON2_ITERATIONS", int(params.Iterations)))
+	parallelism := envInt("ARGON2_PARALLELISM", int(params.Parallelism))
+	if parallelism > 255 {
+		return nil, fmt.Errorf("ARGON2_PARALLELISM must be at most 255")
+	}
+	params.Parallelism = uint8(parallelism)
+
+	return auth.NewPasswordHasher(algorithm, params, envInt("BCRYPT_COST", auth.DefaultBcryptCost))
+}
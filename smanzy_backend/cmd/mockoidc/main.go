@@ -0,0 +1,40 @@
+// Command mockoidc runs a local OpenID Connect provider for trying out the
+// OIDC sign-in without a real identity provider. Every sign-in is approved
+// immediately for the user given by the flags.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/ristep/smanzy_backend/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "Address to listen on")
+	clientID := flag.String("client-id", "smanzy", "Expected OIDC_CLIENT_ID")
+	clientSecret := flag.String("client-secret", "smanzy-secret", "Expected OIDC_CLIENT_SECRET")
+	subject := flag.String("sub", "mock-user-1", "Subject of the signed-in user")
+	email := flag.String("email", "mock.user@example.com", "Email of the signed-in user")
+	name := flag.String("name", "Mock User", "Name of the signed-in user")
+	emailVerified := flag.Bool("email-verified", true, "Whether the email is reported as verified")
+	flag.Parse()
+
+	provider, err := oidctest.New(*clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("Failed to create provider: %v", err)
+	}
+	provider.Issuer = "http://" + *addr
+	provider.User = oidctest.User{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: *emailVerified,
+		Name:          *name,
+	}
+
+	log.Printf("Mock OIDC provider listening on %s (OIDC_ISSUER_URL=%s)", *addr, provider.Issuer)
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
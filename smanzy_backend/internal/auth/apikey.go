@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix marks personal API keys so they can be told apart from JWTs
+// in an Authorization header (and found by secret scanners)
+const APIKeyPrefix = "smz_"
+
+// apiKeyDisplayLength is how many characters of a key are kept in plain text
+// to help users recognise it (the prefix plus 8 random characters)
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+// API key scopes. A key can only be used on endpoints that require one of
+// its scopes.
+const (
+	ScopeMediaWrite = "media:write" // Upload media
+	ScopeVideosSync = "videos:sync" // Trigger the YouTube video sync
+)
+
+// APIKeyScopes lists every scope a key can be granted
+var APIKeyScopes = []string{ScopeMediaWrite, ScopeVideosSync}
+
+// NewAPIKey returns a new API key, its hash (the only form that is stored)
+// and the display prefix
+func NewAPIKey() (key, hash, displayPrefix string, err error) {
+	token, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = APIKeyPrefix + token
+	return key, HashOpaqueToken(key), key[:apiKeyDisplayLength], nil
+}
+
+// IsAPIKey reports whether a bearer credential looks like an API key
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// ParseScopes validates requested scopes and returns them deduplicated in
+// APIKeyScopes order
+func ParseScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	wanted := make(map[string]bool, len(requested))
+	for _, s := range requested {
+		if !HasScope(APIKeyScopes, s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		wanted[s] = true
+	}
+
+	scopes := make([]string, 0, len(wanted))
+	for _, s := range APIKeyScopes {
+		if wanted[s] {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// HasScope reports whether scope is one of scopes
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
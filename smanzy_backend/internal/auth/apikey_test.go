@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, hash, prefix, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	if !IsAPIKey(key) {
+		t.Fatalf("expected key %q to carry the %s prefix", key, APIKeyPrefix)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != apiKeyDisplayLength {
+		t.Fatalf("unexpected display prefix %q for key %q", prefix, key)
+	}
+	if hash != HashOpaqueToken(key) {
+		t.Fatal("expected hash to be the opaque token hash of the key")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{ScopeVideosSync, ScopeMediaWrite, ScopeVideosSync})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(scopes, " ") != ScopeMediaWrite+" "+ScopeVideosSync {
+		t.Fatalf("expected deduplicated scopes in canonical order, got %v", scopes)
+	}
+
+	if _, err := ParseScopes(nil); err == nil {
+		t.Fatal("expected an error without scopes")
+	}
+	if _, err := ParseScopes([]string{"admin"}); err == nil {
+		t.Fatal("expected an error for an unknown scope")
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Session cookie names. The access and refresh cookies are HttpOnly; the
+// CSRF cookie is readable by the SPA, which echoes it in CSRFHeader.
+const (
+	AccessTokenCookie  = "smanzy_access"
+	RefreshTokenCookie = "smanzy_refresh"
+	CSRFCookie         = "smanzy_csrf"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// Cookie paths. The refresh token is only ever sent to the refresh endpoint.
+const (
+	accessTokenCookiePath  = "/api"
+	refreshTokenCookiePath = "/api/auth/refresh"
+	csrfCookiePath         = "/"
+)
+
+// SessionCookies keeps the tokens of browser sessions in HttpOnly cookies
+// instead of handing them to JavaScript. Requests authenticated by cookie
+// are protected against CSRF by the double-submit pattern: the CSRF cookie
+// must be echoed in the X-CSRF-Token header, which other sites cannot do.
+type SessionCookies struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string // Empty for a host-only cookie
+}
+
+// ParseSameSite parses a SameSite setting: lax, strict or none
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite %q, expected lax, strict or none", value)
+}
+
+// Set stores a token pair in cookies, along with csrfToken. The CSRF cookie
+// lives as long as the refresh token.
+func (sc *SessionCookies) Set(w http.ResponseWriter, pair *TokenPair, csrfToken string) {
+	sc.set(w, AccessTokenCookie, pair.AccessToken, accessTokenCookiePath, int(AccessTokenTTL.Seconds()), true)
+
+	refreshMaxAge := int(time.Until(pair.RefreshExpiresAt).Seconds())
+	sc.set(w, RefreshTokenCookie, pair.RefreshToken, refreshTokenCookiePath, refreshMaxAge, true)
+	sc.set(w, CSRFCookie, csrfToken, csrfCookiePath, refreshMaxAge, false)
+}
+
+// SetCSRF stores a CSRF token without touching the session cookies
+func (sc *SessionCookies) SetCSRF(w http.ResponseWriter, csrfToken string) {
+	sc.set(w, CSRFCookie, csrfToken, csrfCookiePath, int(RefreshTokenTTL.Seconds()), false)
+}
+
+// Clear removes every session cookie
+func (sc *SessionCookies) Clear(w http.ResponseWriter) {
+	sc.set(w, AccessTokenCookie, "", accessTokenCookiePath, -1, true)
+	sc.set(w, RefreshTokenCookie, "", refreshTokenCookiePath, -1, true)
+	sc.set(w, CSRFCookie, "", csrfCookiePath, -1, false)
+}
+
+// set writes one cookie; maxAge < 0 deletes it
+func (sc *SessionCookies) set(w http.ResponseWriter, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   sc.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   sc.Secure,
+		SameSite: sc.SameSite,
+	})
+}
+
+// NewCSRFToken returns a random CSRF token
+func NewCSRFToken() (string, error) {
+	token, _, err := NewOpaqueToken()
+	return token, err
+}
+
+// CSRFSafeMethod reports whether requests with the method cannot change
+// state and so need no CSRF token
+func CSRFSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// ValidCSRF reports whether the request echoes its CSRF cookie in the
+// X-CSRF-Token header
+func ValidCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// DefaultBcryptCost is the bcrypt cost used unless configured otherwise
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+// Argon2Params are the argon2id cost parameters
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the RFC 9106 recommendation for memory
+// constrained environments (64 MiB, 3 passes)
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// UnusablePassword is stored instead of a hash for accounts that have no
+// password yet; no password matches it
+const UnusablePassword = "!"
+
+// ErrUnknownHashFormat is returned for stored hashes of no supported algorithm
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes new passwords with the configured algorithm and
+// verifies hashes of every supported one. Hashes are stored in PHC string
+// format ($argon2id$v=19$m=...,t=...,p=...$salt$hash); bcrypt hashes keep
+// their own $2a$ format.
+type PasswordHasher struct {
+	algorithm  string
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+// NewPasswordHasher creates a hasher for the given algorithm. Parameters of
+// the algorithm not in use are still needed to tell whether hashes made with
+// it are outdated.
+func NewPasswordHasher(algorithm string, argon2Params Argon2Params, bcryptCost int) (*PasswordHasher, error) {
+	switch algorithm {
+	case HashArgon2id:
+		if argon2Params.Memory < 8*uint32(argon2Params.Parallelism) || argon2Params.Iterations < 1 ||
+			argon2Params.Parallelism < 1 || argon2Params.SaltLength < 8 || argon2Params.KeyLength < 16 {
+			return nil, fmt.Errorf("invalid argon2id parameters: %+v", argon2Params)
+		}
+	case HashBcrypt:
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost %d, expected %d-%d", bcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q, expected %s or %s", algorithm, HashArgon2id, HashBcrypt)
+	}
+
+	return &PasswordHasher{
+		algorithm:  algorithm,
+		argon2:     argon2Params,
+		bcryptCost: bcryptCost,
+	}, nil
+}
+
+// Hash hashes a password with the configured algorithm
+func (ph *PasswordHasher) Hash(password string) (string, error) {
+	if ph.algorithm == HashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), ph.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, ph.argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	p := ph.argon2
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", HashArgon2id, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether the password matches the stored hash, and if so
+// whether the hash should be replaced because it was made with another
+// algorithm or with outdated parameters
+func (ph *PasswordHasher) Verify(password, encoded string) (match, rehash bool, err error) {
+	switch {
+	case encoded == UnusablePassword:
+		return false, false, nil
+
+	case strings.HasPrefix(encoded, "$"+HashArgon2id+"$"):
+		params, salt, key, err := parseArgon2Hash(encoded)
+		if err != nil {
+			return false, false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false, nil
+		}
+		return true, ph.algorithm != HashArgon2id || params != ph.argon2, nil
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, err
+		}
+		return true, ph.algorithm != HashBcrypt || cost != ph.bcryptCost, nil
+	}
+
+	return false, false, ErrUnknownHashFormat
+}
+
+// parseArgon2Hash splits a PHC formatted argon2id hash into its parameters,
+// salt and key
+func parseArgon2Hash(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 key: %w", err)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
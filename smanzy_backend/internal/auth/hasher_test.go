@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keep the tests fast
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasher_Argon2idRoundTrip(t *testing.T) {
+	ph, err := NewPasswordHasher(HashArgon2id, testArgon2Params, bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	hash, err := ph.Hash("correct horse 1")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected hash format: %s", hash)
+	}
+
+	match, rehash, err := ph.Verify("correct horse 1", hash)
+	if err != nil || !match || rehash {
+		t.Fatalf("expected match without rehash, got match=%v rehash=%v err=%v", match, rehash, err)
+	}
+
+	match, _, err = ph.Verify("wrong horse 1", hash)
+	if err != nil || match {
+		t.Fatalf("expected mismatch, got match=%v err=%v", match, err)
+	}
+}
+
+func TestPasswordHasher_RehashOutdated(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+
+	ph, err := NewPasswordHasher(HashArgon2id, testArgon2Params, bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	match, rehash, err := ph.Verify("secret123", string(legacy))
+	if err != nil || !match || !rehash {
+		t.Fatalf("expected bcrypt hash to match and need a rehash, got match=%v rehash=%v err=%v", match, rehash, err)
+	}
+
+	weaker := testArgon2Params
+	weaker.Iterations = 2
+	old, err := NewPasswordHasher(HashArgon2id, weaker, bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	hash, err := old.Hash("secret123")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if _, rehash, _ := ph.Verify("secret123", hash); !rehash {
+		t.Fatal("expected argon2id hash with other parameters to need a rehash")
+	}
+
+	bc, err := NewPasswordHasher(HashBcrypt, testArgon2Params, bcrypt.MinCost+1)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	if _, rehash, _ := bc.Verify("secret123", string(legacy)); !rehash {
+		t.Fatal("expected bcrypt hash with a lower cost to need a rehash")
+	}
+}
+
+func TestPasswordHasher_UnknownFormat(t *testing.T) {
+	ph, err := NewPasswordHasher(HashArgon2id, testArgon2Params, bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	if _, _, err := ph.Verify("secret123", "plaintext"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Fatalf("expected ErrUnknownHashFormat, got %v", err)
+	}
+
+	if match, _, err := ph.Verify("", UnusablePassword); match || err != nil {
+		t.Fatalf("expected no password to match the unusable marker, got %v, %v", match, err)
+	}
+}
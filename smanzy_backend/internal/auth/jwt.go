@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
@@ -9,79 +11,241 @@ import (
 	"github.com/ristep/smanzy_backend/internal/models"
 )
 
+// Token lifetimes
+const (
+	AccessTokenTTL        = 15 * time.Minute
+	RefreshTokenTTL       = 7 * 24 * time.Hour
+	ImpersonationTokenTTL = 30 * time.Minute
+)
+
+// TokenType identifies what a token may be used for. Every token carries its
+// type in the "typ" claim and validation always checks it, so a token minted
+// for one purpose can never be replayed for another.
+type TokenType string
+
+const (
+	// TokenTypeAccess authenticates API requests as a Bearer token
+	TokenTypeAccess TokenType = "access"
+	// TokenTypeRefresh may only be exchanged at /api/auth/refresh
+	TokenTypeRefresh TokenType = "refresh"
+	// TokenTypeEmailVerification is sent by email to confirm the address
+	TokenTypeEmailVerification TokenType = "email_verification"
+	// TokenTypeTwoFactorChallenge is returned by a password login for accounts
+	// with 2FA and may only be exchanged at /api/auth/2fa/verify
+	TokenTypeTwoFactorChallenge TokenType = "2fa_challenge"
+)
+
+// ErrWrongTokenType is returned when a valid token is presented for the wrong purpose
+var ErrWrongTokenType = errors.New("unexpected token type")
+
 // CustomClaims represents the custom claims in the JWT token
 type CustomClaims struct {
-	UserID uint     `json:"user_id"`
-	Email  string   `json:"email"`
-	Name   string   `json:"name"`
-	Roles  []string `json:"roles"`
+	TokenType TokenType `json:"typ"`
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Roles     []string  `json:"roles,omitempty"`
+	FamilyID  string    `json:"fid,omitempty"` // Refresh token family, shared by all rotations of one login
+	Version   int64     `json:"ver"`           // User token version at issue time
+	MFA       bool      `json:"mfa,omitempty"` // Session was authenticated with a second factor
+	// ImpersonatorID is the admin acting as UserID; set only on impersonation tokens
+	ImpersonatorID uint `json:"imp,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTService handles JWT token generation and validation
+// JWTService handles JWT token generation and validation. Tokens are signed
+// with HS256 and a shared secret, or with the signing key of a KeySet
+// (RS256/EdDSA, identified by the kid header) so that other services can
+// verify them using only the published public keys.
 type JWTService struct {
 	secretKey string
+	keySet    *KeySet
 }
 
-// NewJWTService creates a new JWT service with the given secret key
+// NewJWTService creates a new JWT service that signs with HS256 and the given secret key
 func NewJWTService(secretKey string) *JWTService {
 	return &JWTService{
 		secretKey: secretKey,
 	}
 }
 
+// NewJWTServiceWithKeys creates a JWT service that signs with the key set's
+// signing key. If secretKey is not empty, HS256 tokens signed with it are
+// still accepted, so sessions issued before switching keep working.
+func NewJWTServiceWithKeys(keySet *KeySet, secretKey string) *JWTService {
+	return &JWTService{
+		secretKey: secretKey,
+		keySet:    keySet,
+	}
+}
+
+// JWKS returns the public verification keys; empty when signing with HS256
+func (js *JWTService) JWKS() JWKS {
+	if js.keySet == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return js.keySet.JWKS()
+}
+
 // TokenPair represents both access and refresh tokens
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+
+	// Refresh token metadata, needed by callers that persist the token
+	RefreshTokenID   string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
-// GenerateTokenPair generates both access and refresh tokens for a user
-func (js *JWTService) GenerateTokenPair(user *models.User) (*TokenPair, error) {
+// NewTokenID returns a random identifier suitable for a jti or token family ID
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateTokenPair generates both access and refresh tokens for a user.
+// The refresh token carries a unique jti and the given family ID so it can be
+// tracked server-side and rotated on every use. mfa records whether the
+// session was established with a second factor.
+func (js *JWTService) GenerateTokenPair(user *models.User, familyID string, mfa bool) (*TokenPair, error) {
 	// Extract role names from user roles
 	roleNames := make([]string, len(user.Roles))
 	for i, role := range user.Roles {
 		roleNames[i] = role.Name
 	}
 
-	// Generate access token (short-lived: 15 minutes)
-	accessToken, err := js.generateToken(user, roleNames, 15*time.Minute)
+	now := time.Now()
+
+	// Generate access token (short-lived). It carries its own jti so it can be
+	// denylisted on logout, and the family ID of the session it belongs to.
+	accessID, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := js.generateToken(CustomClaims{
+		TokenType:        TokenTypeAccess,
+		UserID:           user.ID,
+		Email:            user.Email,
+		Name:             user.Name,
+		Roles:            roleNames,
+		FamilyID:         familyID,
+		Version:          user.TokenVersion,
+		MFA:              mfa,
+		RegisteredClaims: registeredClaims(now, AccessTokenTTL, accessID),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	// Generate refresh token (long-lived: 7 days)
-	refreshToken, err := js.generateToken(user, roleNames, 7*24*time.Hour)
+	// Generate refresh token (long-lived, tracked by jti)
+	refreshID, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := js.generateToken(CustomClaims{
+		TokenType:        TokenTypeRefresh,
+		UserID:           user.ID,
+		Email:            user.Email,
+		Name:             user.Name,
+		Roles:            roleNames,
+		FamilyID:         familyID,
+		Version:          user.TokenVersion,
+		MFA:              mfa,
+		RegisteredClaims: registeredClaims(now, RefreshTokenTTL, refreshID),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
 	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshTokenID:   refreshID,
+		RefreshExpiresAt: now.Add(RefreshTokenTTL),
 	}, nil
 }
 
-// generateToken is a helper function to create a JWT token with the given duration
-func (js *JWTService) generateToken(user *models.User, roleNames []string, duration time.Duration) (string, error) {
+// GenerateImpersonationToken creates an access token that authenticates as
+// user on behalf of the admin impersonatorID. It has no refresh token, so
+// the impersonation ends when it expires.
+func (js *JWTService) GenerateImpersonationToken(user *models.User, impersonatorID uint) (token, id string, expiresAt time.Time, err error) {
+	id, err = NewTokenID()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	roleNames := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roleNames[i] = role.Name
+	}
+
 	now := time.Now()
-	expirationTime := now.Add(duration)
-
-	claims := CustomClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Name:   user.Name,
-		Roles:  roleNames,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-			Issuer:    "um-api",
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(js.secretKey))
+	token, err = js.generateToken(CustomClaims{
+		TokenType:        TokenTypeAccess,
+		UserID:           user.ID,
+		Email:            user.Email,
+		Name:             user.Name,
+		Roles:            roleNames,
+		Version:          user.TokenVersion,
+		ImpersonatorID:   impersonatorID,
+		RegisteredClaims: registeredClaims(now, ImpersonationTokenTTL, id),
+	})
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to generate impersonation token: %w", err)
+	}
+
+	return token, id, now.Add(ImpersonationTokenTTL), nil
+}
+
+// GeneratePurposeToken creates a short-lived token for the user that is only
+// accepted where the given token type is expected (e.g. email verification)
+func (js *JWTService) GeneratePurposeToken(user *models.User, tokenType TokenType, duration time.Duration) (string, error) {
+	if tokenType == TokenTypeAccess || tokenType == TokenTypeRefresh {
+		return "", fmt.Errorf("use GenerateTokenPair for %s tokens", tokenType)
+	}
+
+	id, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	return js.generateToken(CustomClaims{
+		TokenType:        tokenType,
+		UserID:           user.ID,
+		Email:            user.Email,
+		Version:          user.TokenVersion,
+		RegisteredClaims: registeredClaims(time.Now(), duration, id),
+	})
+}
+
+// registeredClaims builds the standard claims for a token issued at now
+func registeredClaims(now time.Time, duration time.Duration, id string) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		ID:        id,
+		ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    "um-api",
+	}
+}
+
+// generateToken is a helper function to sign the given claims
+func (js *JWTService) generateToken(claims CustomClaims) (string, error) {
+	var tokenString string
+	var err error
+
+	if js.keySet != nil {
+		key := js.keySet.SigningKey()
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		tokenString, err = token.SignedString(key.Private)
+	} else {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		tokenString, err = token.SignedString([]byte(js.secretKey))
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -89,17 +253,12 @@ func (js *JWTService) generateToken(user *models.User, roleNames []string, durat
 	return tokenString, nil
 }
 
-// ValidateToken parses and validates a JWT token, returning the claims or an error
-func (js *JWTService) ValidateToken(tokenString string) (*CustomClaims, error) {
+// ValidateToken parses and validates a JWT token of the expected type,
+// returning the claims or an error
+func (js *JWTService) ValidateToken(tokenString string, expected TokenType) (*CustomClaims, error) {
 	claims := &CustomClaims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Verify the signing method is the expected one
-		if token.Method != jwt.SigningMethodHS256 {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(js.secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, js.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -109,10 +268,53 @@ func (js *JWTService) ValidateToken(tokenString string) (*CustomClaims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if claims.TokenType != expected {
+		return nil, ErrWrongTokenType
+	}
+
 	return claims, nil
 }
 
-// ValidateRefreshToken is an alias for ValidateToken used for refresh tokens
+// verificationKey picks the key for a parsed token. The key type is tied to
+// the algorithm, so an RS256/EdDSA public key can never be used as an HMAC
+// secret.
+func (js *JWTService) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method {
+	case jwt.SigningMethodHS256:
+		if js.secretKey == "" {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return []byte(js.secretKey), nil
+
+	case jwt.SigningMethodRS256, jwt.SigningMethodEdDSA:
+		if js.keySet == nil {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := js.keySet.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if key.Method != token.Method {
+			return nil, errors.New("signing method does not match key")
+		}
+		return key.Public, nil
+	}
+
+	return nil, errors.New("unexpected signing method")
+}
+
+// ValidateRefreshToken validates a refresh token and ensures it carries the
+// jti and family ID needed to look it up in the refresh token store
 func (js *JWTService) ValidateRefreshToken(tokenString string) (*CustomClaims, error) {
-	return js.ValidateToken(tokenString)
+	claims, err := js.ValidateToken(tokenString, TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" || claims.FamilyID == "" {
+		return nil, errors.New("refresh token is not tracked")
+	}
+
+	return claims, nil
 }
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+func testUser() *models.User {
+	return &models.User{
+		ID:    42,
+		Email: "user@example.com",
+		Name:  "Test User",
+		Roles: []models.Role{{ID: 1, Name: "user"}},
+	}
+}
+
+func TestValidateToken_AcceptsMatchingType(t *testing.T) {
+	js := NewJWTService("test-secret")
+
+	pair, err := js.GenerateTokenPair(testUser(), "family-1", false)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	claims, err := js.ValidateToken(pair.AccessToken, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("expected access token to validate, got %v", err)
+	}
+	if claims.UserID != 42 || claims.TokenType != TokenTypeAccess {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	claims, err = js.ValidateRefreshToken(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("expected refresh token to validate, got %v", err)
+	}
+	if claims.ID != pair.RefreshTokenID || claims.FamilyID != "family-1" {
+		t.Fatalf("refresh token not tracked: %+v", claims)
+	}
+}
+
+func TestValidateToken_RejectsRefreshTokenAsAccess(t *testing.T) {
+	js := NewJWTService("test-secret")
+
+	pair, err := js.GenerateTokenPair(testUser(), "family-1", false)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	if _, err := js.ValidateToken(pair.RefreshToken, TokenTypeAccess); !errors.Is(err, ErrWrongTokenType) {
+		t.Fatalf("expected ErrWrongTokenType for refresh token, got %v", err)
+	}
+	if _, err := js.ValidateRefreshToken(pair.AccessToken); !errors.Is(err, ErrWrongTokenType) {
+		t.Fatalf("expected ErrWrongTokenType for access token, got %v", err)
+	}
+}
+
+func TestValidateToken_RejectsUntypedToken(t *testing.T) {
+	js := NewJWTService("test-secret")
+
+	// Tokens minted before the typ claim existed must not be accepted
+	legacy, err := js.generateToken(CustomClaims{
+		UserID:           42,
+		RegisteredClaims: registeredClaims(time.Now(), time.Minute, ""),
+	})
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	if _, err := js.ValidateToken(legacy, TokenTypeAccess); !errors.Is(err, ErrWrongTokenType) {
+		t.Fatalf("expected ErrWrongTokenType for untyped token, got %v", err)
+	}
+}
+
+func TestGeneratePurposeToken(t *testing.T) {
+	js := NewJWTService("test-secret")
+	const purpose TokenType = "test_purpose"
+
+	token, err := js.GeneratePurposeToken(testUser(), purpose, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate purpose token: %v", err)
+	}
+
+	if _, err := js.ValidateToken(token, purpose); err != nil {
+		t.Fatalf("expected purpose token to validate, got %v", err)
+	}
+	if _, err := js.ValidateToken(token, TokenTypeAccess); !errors.Is(err, ErrWrongTokenType) {
+		t.Fatalf("expected purpose token to be rejected as access token, got %v", err)
+	}
+
+	if _, err := js.GeneratePurposeToken(testUser(), TokenTypeAccess, time.Minute); err == nil {
+		t.Fatal("expected GeneratePurposeToken to refuse access tokens")
+	}
+}
+
+func TestValidateToken_RejectsOtherSecret(t *testing.T) {
+	js := NewJWTService("test-secret")
+	other := NewJWTService("other-secret")
+
+	pair, err := other.GenerateTokenPair(testUser(), "family-1", false)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	_, err = js.ValidateToken(pair.AccessToken, TokenTypeAccess)
+	if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+}
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	js := NewJWTService("test-secret")
+
+	token, id, expiresAt, err := js.GenerateImpersonationToken(testUser(), 7)
+	if err != nil {
+		t.Fatalf("failed to generate impersonation token: %v", err)
+	}
+	if time.Until(expiresAt) > ImpersonationTokenTTL {
+		t.Fatalf("impersonation token outlives its TTL: %v", expiresAt)
+	}
+
+	claims, err := js.ValidateToken(token, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("expected impersonation token to validate as access token, got %v", err)
+	}
+	if claims.UserID != 42 || claims.ImpersonatorID != 7 || claims.ID != id {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if claims.FamilyID != "" {
+		t.Fatalf("impersonation token must not belong to a session: %+v", claims)
+	}
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey stores a private key (and optionally only its public half) as PEM
+func writeKey(t *testing.T, dir, kid string, priv crypto.Signer, publicOnly bool) {
+	t.Helper()
+
+	var block *pem.Block
+	if publicOnly {
+		der, err := x509.MarshalPKIXPublicKey(priv.Public())
+		if err != nil {
+			t.Fatalf("failed to marshal public key: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			t.Fatalf("failed to marshal private key: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
+
+func TestLoadKeySet_SignsWithNewestKey(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+	writeKey(t, dir, "2025-01", rsaKey, false)
+	writeKey(t, dir, "2025-06", edKey, false)
+
+	ks, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("failed to load key set: %v", err)
+	}
+	if ks.SigningKey().ID != "2025-06" || ks.SigningKey().Method != jwt.SigningMethodEdDSA {
+		t.Fatalf("expected newest key to sign, got %s", ks.SigningKey().ID)
+	}
+
+	ks, err = LoadKeySet(dir, "2025-01")
+	if err != nil {
+		t.Fatalf("failed to load key set: %v", err)
+	}
+	if ks.SigningKey().ID != "2025-01" || ks.SigningKey().Method != jwt.SigningMethodRS256 {
+		t.Fatalf("expected JWT_SIGNING_KID to select the key, got %s", ks.SigningKey().ID)
+	}
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 published keys, got %d", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].E != "AQAB" || jwks.Keys[1].Crv != "Ed25519" {
+		t.Fatalf("unexpected jwks: %+v", jwks)
+	}
+}
+
+func TestLoadKeySet_RejectsPublicSigningKey(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+	writeKey(t, dir, "retired", edKey, true)
+
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Fatal("expected error without a private key")
+	}
+	if _, err := LoadKeySet(dir, "retired"); err == nil {
+		t.Fatal("expected error when signing key is public only")
+	}
+}
+
+func TestJWTServiceWithKeys_Rotation(t *testing.T) {
+	_, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	_, newPriv, _ := ed25519.GenerateKey(rand.Reader)
+	oldKey := &SigningKey{ID: "old", Method: jwt.SigningMethodEdDSA, Private: oldPriv, Public: oldPriv.Public()}
+	newKey := &SigningKey{ID: "new", Method: jwt.SigningMethodEdDSA, Private: newPriv, Public: newPriv.Public()}
+
+	before := NewJWTServiceWithKeys(NewKeySet(oldKey), "")
+	pair, err := before.GenerateTokenPair(testUser(), "family-1", false)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	// After rotation the old key only verifies
+	oldVerifyOnly := &SigningKey{ID: "old", Method: jwt.SigningMethodEdDSA, Public: oldPriv.Public()}
+	after := NewJWTServiceWithKeys(NewKeySet(newKey, oldVerifyOnly), "")
+	if _, err := after.ValidateToken(pair.AccessToken, TokenTypeAccess); err != nil {
+		t.Fatalf("expected token signed with retired key to validate, got %v", err)
+	}
+
+	// Once the old key is removed its tokens are rejected
+	removed := NewJWTServiceWithKeys(NewKeySet(newKey), "")
+	if _, err := removed.ValidateToken(pair.AccessToken, TokenTypeAccess); err == nil {
+		t.Fatal("expected token signed with removed key to be rejected")
+	}
+}
+
+func TestJWTServiceWithKeys_HS256Fallback(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key := &SigningKey{ID: "k1", Method: jwt.SigningMethodEdDSA, Private: priv, Public: priv.Public()}
+
+	legacy, err := NewJWTService("test-secret").GenerateTokenPair(testUser(), "family-1", false)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	withSecret := NewJWTServiceWithKeys(NewKeySet(key), "test-secret")
+	if _, err := withSecret.ValidateToken(legacy.AccessToken, TokenTypeAccess); err != nil {
+		t.Fatalf("expected HS256 token to validate while the secret is configured, got %v", err)
+	}
+
+	withoutSecret := NewJWTServiceWithKeys(NewKeySet(key), "")
+	if _, err := withoutSecret.ValidateToken(legacy.AccessToken, TokenTypeAccess); err == nil {
+		t.Fatal("expected HS256 token to be rejected without a secret")
+	}
+}
+
+func TestJWTServiceWithKeys_RejectsAlgorithmConfusion(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key := &SigningKey{ID: "k1", Method: jwt.SigningMethodEdDSA, Private: priv, Public: priv.Public()}
+	js := NewJWTServiceWithKeys(NewKeySet(key), "")
+
+	// HMAC-sign with the public key bytes, the classic RS/HS confusion attack
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{
+		TokenType:        TokenTypeAccess,
+		UserID:           42,
+		RegisteredClaims: registeredClaims(time.Now(), time.Minute, "x"),
+	})
+	token.Header["kid"] = "k1"
+	forged, err := token.SignedString([]byte(priv.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	if _, err := js.ValidateToken(forged, TokenTypeAccess); err == nil {
+		t.Fatal("expected HS256 token signed with the public key to be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Password policy limits. bcrypt ignores everything past 72 bytes, so longer
+// passwords are rejected rather than silently truncated.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// PasswordPolicyError describes why a password was rejected by the policy.
+// Its message is safe to show to the user.
+type PasswordPolicyError struct {
+	msg string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.msg
+}
+
+// Password policy violations
+var (
+	ErrPasswordTooShort    = &PasswordPolicyError{"password must be at least 8 characters long"}
+	ErrPasswordTooLong     = &PasswordPolicyError{"password must be at most 72 bytes long"}
+	ErrPasswordTooSimple   = &PasswordPolicyError{"password must contain at least one letter and one digit"}
+	ErrPasswordMatchesUser = &PasswordPolicyError{"password must not contain the email address"}
+)
+
+// ValidatePassword checks a new password against the password policy
+func ValidatePassword(password, email string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return ErrPasswordTooSimple
+	}
+
+	if email != "" {
+		lower := strings.ToLower(password)
+		local := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+		if strings.Contains(lower, strings.ToLower(email)) || (len(local) >= 4 && strings.Contains(lower, local)) {
+			return ErrPasswordMatchesUser
+		}
+	}
+
+	return nil
+}
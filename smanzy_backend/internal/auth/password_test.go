@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     error
+	}{
+		{"valid", "correct4horse", "user@example.com", nil},
+		{"too short", "abc123", "user@example.com", ErrPasswordTooShort},
+		{"too long", strings.Repeat("a1", 40), "user@example.com", ErrPasswordTooLong},
+		{"letters only", "onlyletters", "user@example.com", ErrPasswordTooSimple},
+		{"digits only", "1234567890", "user@example.com", ErrPasswordTooSimple},
+		{"contains email", "User@Example.com1", "user@example.com", ErrPasswordMatchesUser},
+		{"contains local part", "johndoe2024", "johndoe@example.com", ErrPasswordMatchesUser},
+		{"short local part ignored", "bob-is-great1", "bob@example.com", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePassword(tt.password, tt.email); !errors.Is(err, tt.want) {
+				t.Fatalf("ValidatePassword(%q) = %v, want %v", tt.password, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+// Permissions are granted to roles; a user has the union of the permissions
+// of their roles. Names are resource:action, with an ":any" suffix for
+// actions on other users' resources.
+const (
+	PermMediaUpload      = "media:upload"      // Upload media
+	PermMediaWriteAny    = "media:write:any"   // Edit anyone's media
+	PermMediaDeleteAny   = "media:delete:any"  // Delete anyone's media
+	PermAlbumsReadAny    = "albums:read:any"   // List every user's albums
+	PermVideosSync       = "videos:sync"       // Trigger the YouTube video sync
+	PermUsersRead        = "users:read"        // View users and their login history
+	PermUsersWrite       = "users:write"       // Edit, delete, restore, log out and unlock users
+	PermUsersImpersonate = "users:impersonate" // Act as another user
+	PermRolesAssign      = "roles:assign"      // Assign roles to and remove roles from users
+	PermRolesManage      = "roles:manage"      // Create, rename and delete roles and set their permissions
+	PermInvitesManage    = "invites:manage"    // Create, list and delete invitation codes
+	PermSettingsWrite    = "settings:write"    // Change site settings
+	PermAuditRead        = "audit:read"        // View the admin audit log
+)
+
+// Built-in roles, seeded at startup. They cannot be renamed or deleted.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// BuiltInRoles lists the roles seeded at startup
+var BuiltInRoles = []string{RoleUser, RoleAdmin}
+
+// PermissionDescriptions lists every permission with a human readable description
+var PermissionDescriptions = map[string]string{
+	PermMediaUpload:      "Upload media",
+	PermMediaWriteAny:    "Edit any user's media",
+	PermMediaDeleteAny:   "Delete any user's media",
+	PermAlbumsReadAny:    "List every user's albums",
+	PermVideosSync:       "Sync videos from YouTube",
+	PermUsersRead:        "View users and their login history",
+	PermUsersWrite:       "Edit, delete, restore, log out and unlock users",
+	PermUsersImpersonate: "Act as another user for support",
+	PermRolesAssign:      "Assign and remove user roles",
+	PermRolesManage:      "Create, rename and delete roles and set their permissions",
+	PermInvitesManage:    "Create, list and delete invitation codes",
+	PermSettingsWrite:    "Change site settings",
+	PermAuditRead:        "View the admin audit log",
+}
+
+// DefaultRolePermissions are granted to the built-in roles at startup. The
+// admin role gets every permission.
+var DefaultRolePermissions = map[string][]string{
+	RoleUser: {PermMediaUpload, PermVideosSync},
+}
+
+// PrivilegedPermissions give access to other users' data or to site wide
+// configuration; holders are subject to the require-admin-2fa setting
+var PrivilegedPermissions = []string{
+	PermMediaWriteAny,
+	PermMediaDeleteAny,
+	PermAlbumsReadAny,
+	PermUsersRead,
+	PermUsersWrite,
+	PermUsersImpersonate,
+	PermRolesAssign,
+	PermRolesManage,
+	PermInvitesManage,
+	PermSettingsWrite,
+	PermAuditRead,
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors (SHA-1), truncated to 6 digits
+func TestValidateTOTP_RFCVectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(secret, tt.code, at)
+		if !ok {
+			t.Fatalf("expected code %s to be valid at %d", tt.code, tt.unix)
+		}
+		if step != TOTPStep(at) {
+			t.Fatalf("expected step %d, got %d", TOTPStep(at), step)
+		}
+	}
+}
+
+func TestValidateTOTP_Skew(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+
+	now := time.Now()
+	previous := totpCode(key, TOTPStep(now)-1)
+	if _, ok := ValidateTOTP(secret, previous, now); !ok {
+		t.Fatal("expected code from the previous step to be accepted")
+	}
+
+	stale := totpCode(key, TOTPStep(now)-3)
+	if _, ok := ValidateTOTP(secret, stale, now); ok {
+		t.Fatal("expected code from three steps ago to be rejected")
+	}
+
+	if _, ok := ValidateTOTP(secret, "12345", now); ok {
+		t.Fatal("expected short code to be rejected")
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("failed to generate recovery codes: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Fatalf("unexpected code format %q", c)
+		}
+		if NormalizeRecoveryCode(" "+strings.ToUpper(c)+" ") != strings.ReplaceAll(c, "-", "") {
+			t.Fatalf("normalization changed code %q", c)
+		}
+		seen[c] = true
+	}
+	if len(seen) != len(codes) {
+		t.Fatal("expected recovery codes to be unique")
+	}
+}
@@ -8,6 +8,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
 const addMediaToAlbum = `-- name: AddMediaToAlbum :exec
@@ -243,6 +244,19 @@ func (q *Queries) ListUserAlbums(ctx context.Context, userID int64) ([]ListUserA
 	return items, nil
 }
 
+const purgeDeletedAlbums = `-- name: PurgeDeletedAlbums :execrows
+DELETE FROM album
+WHERE deleted_at < $1::TIMESTAMPTZ
+`
+
+func (q *Queries) PurgeDeletedAlbums(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedAlbums, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const removeMediaFromAlbum = `-- name: RemoveMediaFromAlbum :exec
 DELETE FROM album_media
 WHERE album_id = $1 AND media_id = $2
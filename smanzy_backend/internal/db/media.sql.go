@@ -8,6 +8,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
 const countPublicMedia = `-- name: CountPublicMedia :one
@@ -271,6 +272,34 @@ func (q *Queries) ListUserMedia(ctx context.Context, userID int64) ([]ListUserMe
 	return items, nil
 }
 
+const listUserStoredNames = `-- name: ListUserStoredNames :many
+SELECT stored_name FROM media
+WHERE user_id = $1
+`
+
+func (q *Queries) ListUserStoredNames(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listUserStoredNames, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var stored_name string
+		if err := rows.Scan(&stored_name); err != nil {
+			return nil, err
+		}
+		items = append(items, stored_name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const permanentlyDeleteMedia = `-- name: PermanentlyDeleteMedia :exec
 DELETE FROM media
 WHERE id = $1
@@ -281,6 +310,40 @@ func (q *Queries) PermanentlyDeleteMedia(ctx context.Context, id int64) error {
 	return err
 }
 
+const purgeDeletedMedia = `-- name: PurgeDeletedMedia :many
+DELETE FROM media
+WHERE deleted_at < $1::TIMESTAMPTZ
+RETURNING id, stored_name
+`
+
+type PurgeDeletedMediaRow struct {
+	ID         int64  `json:"id"`
+	StoredName string `json:"stored_name"`
+}
+
+func (q *Queries) PurgeDeletedMedia(ctx context.Context, cutoff time.Time) ([]PurgeDeletedMediaRow, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeletedMedia, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PurgeDeletedMediaRow
+	for rows.Next() {
+		var i PurgeDeletedMediaRow
+		if err := rows.Scan(&i.ID, &i.StoredName); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const softDeleteMedia = `-- name: SoftDeleteMedia :exec
 UPDATE media
 SET deleted_at = NOW()
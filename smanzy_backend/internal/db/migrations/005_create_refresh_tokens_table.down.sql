@@ -0,0 +1,4 @@
+-- Rollback: Create refresh_tokens table
+-- Description: Drops the refresh_tokens table and its indexes
+
+DROP TABLE IF EXISTS refresh_tokens;
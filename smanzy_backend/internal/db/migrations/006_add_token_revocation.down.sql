@@ -0,0 +1,6 @@
+-- Rollback: Add token revocation
+-- Description: Drops the access token denylist and the per-user token version
+
+DROP TABLE IF EXISTS revoked_access_tokens;
+
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;
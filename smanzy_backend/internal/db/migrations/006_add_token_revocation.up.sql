@@ -0,0 +1,9 @@
+-- Migration: Add token revocation
+-- Description: Adds a per-user token version for logout-everywhere and a denylist for revoked access tokens
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,4 @@
+-- Rollback: Create password_reset_tokens table
+-- Description: Drops the password_reset_tokens table
+
+DROP TABLE IF EXISTS password_reset_tokens;
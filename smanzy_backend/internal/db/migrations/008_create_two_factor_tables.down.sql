@@ -0,0 +1,5 @@
+-- Rollback: Create two-factor authentication tables
+-- Description: Drops the user_recovery_codes and user_totp tables
+
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,19 @@
+-- Migration: Create two-factor authentication tables
+-- Description: Stores per-user TOTP secrets and hashed one-time recovery codes
+
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL, -- Base32 TOTP secret
+    enabled_at TIMESTAMP WITH TIME ZONE, -- NULL until enrollment is confirmed with a valid code
+    last_used_step BIGINT NOT NULL DEFAULT 0, -- Last accepted time step, prevents code replay
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL, -- SHA-256 of the recovery code
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT,
+    UNIQUE (user_id, code_hash)
+);
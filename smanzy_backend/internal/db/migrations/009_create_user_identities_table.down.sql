@@ -0,0 +1,4 @@
+-- Rollback: Create user_identities table
+-- Description: Drops the user_identities table
+
+DROP TABLE IF EXISTS user_identities;
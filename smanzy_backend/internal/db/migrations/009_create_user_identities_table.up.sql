@@ -0,0 +1,14 @@
+-- Migration: Create user_identities table
+-- Description: Links external (OpenID Connect) identities to local users
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL, -- Configured provider name (OIDC_PROVIDER_NAME)
+    subject TEXT NOT NULL, -- The provider's stable user identifier ("sub" claim)
+    email TEXT NOT NULL, -- Email reported by the provider when the link was made
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
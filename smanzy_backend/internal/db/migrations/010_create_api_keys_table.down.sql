@@ -0,0 +1,4 @@
+-- Rollback: Create api_keys table
+-- Description: Drops the api_keys table
+
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,16 @@
+-- Migration: Create api_keys table
+-- Description: Personal API keys for scripts and CI, stored as SHA-256 hashes
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL, -- Leading characters of the key, shown to help tell keys apart
+    key_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the key
+    scopes TEXT NOT NULL, -- Space-separated scopes, e.g. "media:write videos:sync"
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL for keys that do not expire
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
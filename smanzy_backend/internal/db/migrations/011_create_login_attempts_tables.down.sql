@@ -0,0 +1,5 @@
+-- Rollback: Create login attempt tracking tables
+-- Description: Drops the login_lockouts and login_attempts tables
+
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,22 @@
+-- Migration: Create login attempt tracking tables
+-- Description: Records login attempts per account and IP for brute-force protection and temporary lockouts
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL, -- Normalized (lowercase) email as entered, also for unknown accounts
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE, -- NULL when no such account exists
+    ip TEXT NOT NULL,
+    succeeded BOOLEAN NOT NULL,
+    cleared BOOLEAN NOT NULL DEFAULT FALSE, -- Failures stop counting towards a lockout after a successful login or an unlock
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email_created_at ON login_attempts(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip_created_at ON login_attempts(ip, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user_id ON login_attempts(user_id);
+
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    email TEXT PRIMARY KEY, -- Normalized email of the locked account
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
@@ -0,0 +1,4 @@
+-- Rollback: Create user_sessions table
+-- Description: Drops the user_sessions table
+
+DROP TABLE IF EXISTS user_sessions;
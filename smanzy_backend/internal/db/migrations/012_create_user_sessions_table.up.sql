@@ -0,0 +1,15 @@
+-- Migration: Create user_sessions table
+-- Description: One row per login session (refresh token family) with client details for session management
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    family_id TEXT PRIMARY KEY, -- Refresh token family of the session
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL, -- Client IP at login, updated on every refresh
+    user_agent TEXT NOT NULL, -- Client User-Agent at login, updated on every refresh
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL, -- Expiry of the session's current refresh token
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP WITH TIME ZONE, -- Set on logout or revocation
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
@@ -0,0 +1,5 @@
+-- Rollback: Create permissions tables
+-- Description: Drops the role_permissions and permissions tables
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,6 @@
+-- Rollback: Add account deletion schedule
+-- Description: Drops the account deletion schedule
+
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
@@ -0,0 +1,6 @@
+-- Migration: Add account deletion schedule
+-- Description: Adds the time a self-requested account deletion takes effect
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
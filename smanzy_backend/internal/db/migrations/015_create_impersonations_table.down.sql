@@ -0,0 +1,4 @@
+-- Rollback: Create impersonations table
+-- Description: Drops the impersonations table
+
+DROP TABLE IF EXISTS impersonations;
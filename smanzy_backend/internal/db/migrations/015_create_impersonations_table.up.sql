@@ -0,0 +1,16 @@
+-- Migration: Create impersonations table
+-- Description: Records every time an admin starts acting as another user
+
+CREATE TABLE IF NOT EXISTS impersonations (
+    id BIGSERIAL PRIMARY KEY,
+    admin_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- NULL once the admin's account is purged
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    jti TEXT NOT NULL UNIQUE, -- ID of the impersonation access token
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations(user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonations_admin_id ON impersonations(admin_id);
@@ -0,0 +1,4 @@
+-- Rollback: Create invitations table
+-- Description: Drops the invitations table
+
+DROP TABLE IF EXISTS invitations;
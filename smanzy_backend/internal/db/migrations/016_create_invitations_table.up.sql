@@ -0,0 +1,14 @@
+-- Migration: Create invitations table
+-- Description: Invitation codes for invite-only registration, stored as SHA-256 hashes
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    prefix TEXT NOT NULL, -- Leading characters of the code, shown to help tell codes apart
+    code_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the code
+    role_id BIGINT REFERENCES roles(id) ON DELETE CASCADE, -- Granted on registration, in addition to the default role
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    max_uses INTEGER, -- NULL for unlimited
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL for codes that do not expire
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
@@ -0,0 +1,4 @@
+-- Rollback: Create audit log table
+-- Description: Drops the audit log table
+
+DROP TABLE IF EXISTS audit_log;
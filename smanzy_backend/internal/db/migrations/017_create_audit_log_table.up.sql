@@ -0,0 +1,20 @@
+-- Migration: Create audit log table
+-- Description: Records who performed privileged actions, on what, and what changed
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- NULL once the actor's account is purged
+    impersonator_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- Set when the actor was being impersonated
+    action TEXT NOT NULL, -- e.g. user.delete, setting.update
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL DEFAULT '', -- Empty for actions on many targets, such as an import
+    before JSONB NOT NULL DEFAULT '{}', -- Changed fields before the action
+    after JSONB NOT NULL DEFAULT '{}', -- Changed fields after the action
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
@@ -0,0 +1,4 @@
+-- Rollback: Create rate limit counters table
+-- Description: Drops the rate limit counters table
+
+DROP TABLE IF EXISTS rate_limit_counters;
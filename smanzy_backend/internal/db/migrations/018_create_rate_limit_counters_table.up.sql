@@ -0,0 +1,10 @@
+-- Migration: Create rate limit counters table
+-- Description: Shared fixed-window request counters so API replicas enforce the same rate limits
+
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key TEXT PRIMARY KEY, -- Policy and principal, e.g. "api:user:42" or "auth:ip:10.0.0.1"
+    count BIGINT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL -- End of the current window
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_expires_at ON rate_limit_counters(expires_at);
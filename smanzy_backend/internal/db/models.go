@@ -6,6 +6,8 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
 )
 
 type Album struct {
@@ -25,6 +27,71 @@ type AlbumMedium struct {
 	MediaID int64 `json:"media_id"`
 }
 
+type ApiKey struct {
+	ID         int64        `json:"id"`
+	UserID     int64        `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"key_hash"`
+	Scopes     string       `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	CreatedAt  int64        `json:"created_at"`
+}
+
+type AuditLog struct {
+	ID             int64           `json:"id"`
+	ActorID        sql.NullInt64   `json:"actor_id"`
+	ImpersonatorID sql.NullInt64   `json:"impersonator_id"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type"`
+	TargetID       string          `json:"target_id"`
+	Before         json.RawMessage `json:"before"`
+	After          json.RawMessage `json:"after"`
+	Ip             string          `json:"ip"`
+	UserAgent      string          `json:"user_agent"`
+	CreatedAt      int64           `json:"created_at"`
+}
+
+type Impersonation struct {
+	ID        int64         `json:"id"`
+	AdminID   sql.NullInt64 `json:"admin_id"`
+	UserID    int64         `json:"user_id"`
+	Jti       string        `json:"jti"`
+	Ip        string        `json:"ip"`
+	UserAgent string        `json:"user_agent"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	CreatedAt int64         `json:"created_at"`
+}
+
+type Invitation struct {
+	ID        int64         `json:"id"`
+	Prefix    string        `json:"prefix"`
+	CodeHash  string        `json:"code_hash"`
+	RoleID    sql.NullInt64 `json:"role_id"`
+	CreatedBy sql.NullInt64 `json:"created_by"`
+	MaxUses   sql.NullInt32 `json:"max_uses"`
+	Uses      int32         `json:"uses"`
+	ExpiresAt sql.NullTime  `json:"expires_at"`
+	CreatedAt int64         `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	ID        int64         `json:"id"`
+	Email     string        `json:"email"`
+	UserID    sql.NullInt64 `json:"user_id"`
+	Ip        string        `json:"ip"`
+	Succeeded bool          `json:"succeeded"`
+	Cleared   bool          `json:"cleared"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type LoginLockout struct {
+	Email       string    `json:"email"`
+	LockedUntil time.Time `json:"locked_until"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
 type Medium struct {
 	ID         int64          `json:"id"`
 	Filename   string         `json:"filename"`
@@ -38,6 +105,43 @@ type Medium struct {
 	DeletedAt  sql.NullTime   `json:"deleted_at"`
 }
 
+type PasswordResetToken struct {
+	ID        int64        `json:"id"`
+	UserID    int64        `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt int64        `json:"created_at"`
+}
+
+type Permission struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+type RateLimitCounter struct {
+	Key       string    `json:"key"`
+	Count     int64     `json:"count"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RefreshToken struct {
+	ID        int64        `json:"id"`
+	Jti       string       `json:"jti"`
+	FamilyID  string       `json:"family_id"`
+	UserID    int64        `json:"user_id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	RevokedAt sql.NullTime `json:"revoked_at"`
+	CreatedAt int64        `json:"created_at"`
+}
+
+type RevokedAccessToken struct {
+	Jti       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type Role struct {
 	ID        int64  `json:"id"`
 	Name      string `json:"name"`
@@ -45,6 +149,11 @@ type Role struct {
 	UpdatedAt int64  `json:"updated_at"`
 }
 
+type RolePermission struct {
+	RoleID       int64 `json:"role_id"`
+	PermissionID int64 `json:"permission_id"`
+}
+
 type Setting struct {
 	Key       string `json:"key"`
 	Value     string `json:"value"`
@@ -53,20 +162,39 @@ type Setting struct {
 }
 
 type User struct {
-	ID            int64          `json:"id"`
-	Email         string         `json:"email"`
-	Password      string         `json:"password"`
-	Name          string         `json:"name"`
-	Tel           sql.NullString `json:"tel"`
-	Age           sql.NullInt64  `json:"age"`
-	Address       sql.NullString `json:"address"`
-	City          sql.NullString `json:"city"`
-	Country       sql.NullString `json:"country"`
-	Gender        sql.NullString `json:"gender"`
-	EmailVerified sql.NullBool   `json:"email_verified"`
-	CreatedAt     int64          `json:"created_at"`
-	UpdatedAt     int64          `json:"updated_at"`
-	DeletedAt     sql.NullTime   `json:"deleted_at"`
+	ID                  int64          `json:"id"`
+	Email               string         `json:"email"`
+	Password            string         `json:"password"`
+	Name                string         `json:"name"`
+	Tel                 sql.NullString `json:"tel"`
+	Age                 sql.NullInt64  `json:"age"`
+	Address             sql.NullString `json:"address"`
+	City                sql.NullString `json:"city"`
+	Country             sql.NullString `json:"country"`
+	Gender              sql.NullString `json:"gender"`
+	EmailVerified       sql.NullBool   `json:"email_verified"`
+	CreatedAt           int64          `json:"created_at"`
+	UpdatedAt           int64          `json:"updated_at"`
+	DeletedAt           sql.NullTime   `json:"deleted_at"`
+	TokenVersion        int64          `json:"token_version"`
+	DeletionScheduledAt sql.NullTime   `json:"deletion_scheduled_at"`
+}
+
+type UserIdentity struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"`
+	Email     string `json:"email"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type UserRecoveryCode struct {
+	ID        int64        `json:"id"`
+	UserID    int64        `json:"user_id"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt int64        `json:"created_at"`
 }
 
 type UserRole struct {
@@ -74,6 +202,25 @@ type UserRole struct {
 	RoleID int64 `json:"role_id"`
 }
 
+type UserSession struct {
+	FamilyID   string       `json:"family_id"`
+	UserID     int64        `json:"user_id"`
+	Ip         string       `json:"ip"`
+	UserAgent  string       `json:"user_agent"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt time.Time    `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	CreatedAt  int64        `json:"created_at"`
+}
+
+type UserTotp struct {
+	UserID       int64        `json:"user_id"`
+	Secret       string       `json:"secret"`
+	EnabledAt    sql.NullTime `json:"enabled_at"`
+	LastUsedStep int64        `json:"last_used_step"`
+	CreatedAt    int64        `json:"created_at"`
+}
+
 type Video struct {
 	ID           int64          `json:"id"`
 	VideoID      string         `json:"video_id"`
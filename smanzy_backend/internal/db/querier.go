@@ -6,46 +6,152 @@ package db
 
 import (
 	"context"
+	"time"
 )
 
 type Querier interface {
 	AddMediaToAlbum(ctx context.Context, arg AddMediaToAlbumParams) error
 	AssignRole(ctx context.Context, arg AssignRoleParams) error
+	CancelUserDeletion(ctx context.Context, id int64) error
+	ClearLoginFailures(ctx context.Context, email string) error
+	ClearRolePermissions(ctx context.Context, roleID int64) error
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (int64, error)
+	ConsumeRefreshToken(ctx context.Context, jti string) (RefreshToken, error)
+	// Counts the entries ListAuditLog matches
+	CountAuditLog(ctx context.Context, arg CountAuditLogParams) (int64, error)
 	CountPublicMedia(ctx context.Context) (int64, error)
+	CountRoleMembers(ctx context.Context, roleID int64) (int64, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID int64) (int64, error)
+	CountUserAPIKeys(ctx context.Context, userID int64) (int64, error)
+	// Counts the users SearchUsers matches
+	CountUsers(ctx context.Context, arg CountUsersParams) (int64, error)
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error)
 	CreateAlbum(ctx context.Context, arg CreateAlbumParams) (Album, error)
+	CreateAuditLogEntry(ctx context.Context, arg CreateAuditLogEntryParams) error
+	CreateImpersonation(ctx context.Context, arg CreateImpersonationParams) error
+	CreateInvitation(ctx context.Context, arg CreateInvitationParams) (Invitation, error)
 	CreateMedia(ctx context.Context, arg CreateMediaParams) (CreateMediaRow, error)
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) error
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error
 	CreateRole(ctx context.Context, name string) (Role, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) error
+	CreateUserSession(ctx context.Context, arg CreateUserSessionParams) error
 	CreateVideo(ctx context.Context, arg CreateVideoParams) (Video, error)
+	DeleteAllUserAPIKeys(ctx context.Context, userID int64) error
+	// Deletes sessions that ended (were revoked or expired) before cutoff
+	DeleteEndedUserSessions(ctx context.Context, cutoff time.Time) (int64, error)
+	DeleteExpiredLoginLockouts(ctx context.Context) (int64, error)
+	DeleteExpiredRateLimitCounters(ctx context.Context) (int64, error)
+	DeleteExpiredRefreshTokens(ctx context.Context) (int64, error)
+	DeleteExpiredRevokedAccessTokens(ctx context.Context) (int64, error)
+	DeleteInvitation(ctx context.Context, id int64) (DeleteInvitationRow, error)
+	DeleteLoginLockout(ctx context.Context, email string) error
+	// Deletes attempts older than history_cutoff, and attempts on unknown emails,
+	// which are not in any login history, older than window_cutoff
+	DeleteOldLoginAttempts(ctx context.Context, arg DeleteOldLoginAttemptsParams) (int64, error)
+	DeleteRateLimitCounter(ctx context.Context, key string) error
+	DeleteRole(ctx context.Context, id int64) error
+	DeleteUserAPIKey(ctx context.Context, arg DeleteUserAPIKeyParams) (int64, error)
+	DeleteUserRecoveryCodes(ctx context.Context, userID int64) error
+	DeleteUserTOTP(ctx context.Context, userID int64) error
+	EnableUserTOTP(ctx context.Context, userID int64) error
+	FinishLoginAttempt(ctx context.Context, arg FinishLoginAttemptParams) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error)
+	GetAccountLoginFailures(ctx context.Context, arg GetAccountLoginFailuresParams) (GetAccountLoginFailuresRow, error)
 	GetAlbumByID(ctx context.Context, id int64) (Album, error)
 	GetAlbumMedia(ctx context.Context, albumID int64) ([]Medium, error)
+	GetIPLoginFailures(ctx context.Context, arg GetIPLoginFailuresParams) (GetIPLoginFailuresRow, error)
+	GetLoginLockout(ctx context.Context, email string) (time.Time, error)
 	GetMediaByID(ctx context.Context, id int64) (GetMediaByIDRow, error)
+	GetRateLimitCounter(ctx context.Context, key string) (GetRateLimitCounterRow, error)
+	GetRefreshToken(ctx context.Context, jti string) (RefreshToken, error)
 	GetRoleByName(ctx context.Context, name string) (Role, error)
+	GetRoleSummary(ctx context.Context, id int64) (GetRoleSummaryRow, error)
 	GetSetting(ctx context.Context, key string) (string, error)
 	GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error)
 	GetUserByEmailWithDeleted(ctx context.Context, email string) (GetUserByEmailWithDeletedRow, error)
 	GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
+	GetUserPermissions(ctx context.Context, userID int64) ([]string, error)
 	GetUserRoles(ctx context.Context, userID int64) ([]Role, error)
+	GetUserTOTP(ctx context.Context, userID int64) (UserTotp, error)
 	GetVideoByID(ctx context.Context, id int64) (Video, error)
+	GrantRolePermission(ctx context.Context, arg GrantRolePermissionParams) error
+	// Adds count to the counter for key, starting a new window of period_ms when
+	// the current one has ended. The database clock is used so that all replicas
+	// agree on window boundaries.
+	IncrementRateLimitCounter(ctx context.Context, arg IncrementRateLimitCounterParams) (IncrementRateLimitCounterRow, error)
+	IncrementUserTokenVersion(ctx context.Context, id int64) (int64, error)
+	InvalidateUserPasswordResetTokens(ctx context.Context, userID int64) error
+	IsAccessTokenRevoked(ctx context.Context, arg IsAccessTokenRevokedParams) (bool, error)
+	ListActiveUserSessions(ctx context.Context, userID int64) ([]UserSession, error)
 	ListAllAlbums(ctx context.Context) ([]ListAllAlbumsRow, error)
+	// Newest entries first. Zero and empty filters match everything; since and
+	// until are Unix milliseconds.
+	ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]ListAuditLogRow, error)
+	ListInvitations(ctx context.Context) ([]ListInvitationsRow, error)
 	ListPublicMedia(ctx context.Context, arg ListPublicMediaParams) ([]ListPublicMediaRow, error)
+	ListPurgeableUsers(ctx context.Context, cutoff time.Time) ([]int64, error)
+	ListRoleSummaries(ctx context.Context) ([]ListRoleSummariesRow, error)
+	ListRoleUsers(ctx context.Context, roleID int64) ([]ListRoleUsersRow, error)
 	ListSettings(ctx context.Context) ([]ListSettingsRow, error)
+	ListUserAPIKeys(ctx context.Context, userID int64) ([]ApiKey, error)
 	ListUserAlbums(ctx context.Context, userID int64) ([]ListUserAlbumsRow, error)
+	ListUserImpersonations(ctx context.Context, arg ListUserImpersonationsParams) ([]Impersonation, error)
+	ListUserLoginAttempts(ctx context.Context, arg ListUserLoginAttemptsParams) ([]LoginAttempt, error)
 	ListUserMedia(ctx context.Context, userID int64) ([]ListUserMediaRow, error)
-	ListUsers(ctx context.Context) ([]ListUsersRow, error)
+	ListUserSessions(ctx context.Context, arg ListUserSessionsParams) ([]UserSession, error)
+	ListUserStoredNames(ctx context.Context, userID int64) ([]string, error)
 	ListVideos(ctx context.Context, arg ListVideosParams) ([]Video, error)
+	// Serializes attempts on an email and from an IP until the transaction ends.
+	// The email lock is always taken first, so concurrent attempts cannot deadlock.
+	LockLoginAttempts(ctx context.Context, arg LockLoginAttemptsParams) error
 	PermanentlyDeleteMedia(ctx context.Context, id int64) error
+	PermanentlyDeleteUser(ctx context.Context, id int64) (int64, error)
+	PurgeDeletedAlbums(ctx context.Context, cutoff time.Time) (int64, error)
+	PurgeDeletedMedia(ctx context.Context, cutoff time.Time) ([]PurgeDeletedMediaRow, error)
+	RedeemInvitation(ctx context.Context, codeHash string) (RedeemInvitationRow, error)
+	// Replaces an outdated hash of the same password. Matching on the old hash
+	// keeps a concurrent password change from being overwritten.
+	RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error
 	RemoveMediaFromAlbum(ctx context.Context, arg RemoveMediaFromAlbumParams) error
 	RemoveRole(ctx context.Context, arg RemoveRoleParams) error
+	RenameRole(ctx context.Context, arg RenameRoleParams) error
+	// Records an attempt before the password is checked. It counts as a failure
+	// until FinishLoginAttempt marks it as succeeded.
+	ReserveLoginAttempt(ctx context.Context, arg ReserveLoginAttemptParams) (int64, error)
 	RestoreUser(ctx context.Context, id int64) error
+	RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error
+	RevokeAllUserSessions(ctx context.Context, userID int64) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeSession(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int64) error
+	RevokeUserSession(ctx context.Context, arg RevokeUserSessionParams) (int64, error)
+	ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) error
+	// Admin user listing. Empty search and role match everyone; state is one of
+	// active, deleted or all. Search patterns are matched with ILIKE, so the
+	// caller escapes % and _.
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error)
+	SetUserEmailVerified(ctx context.Context, id int64) error
+	SetUserTOTPLastUsedStep(ctx context.Context, arg SetUserTOTPLastUsedStepParams) (int64, error)
 	SoftDeleteAlbum(ctx context.Context, id int64) error
 	SoftDeleteMedia(ctx context.Context, id int64) error
+	SoftDeleteScheduledUsers(ctx context.Context) ([]int64, error)
 	SoftDeleteUser(ctx context.Context, id int64) error
 	SoftDeleteVideo(ctx context.Context, id int64) error
+	TouchAPIKey(ctx context.Context, id int64) error
+	TouchUserSession(ctx context.Context, arg TouchUserSessionParams) error
 	UpdateAlbum(ctx context.Context, arg UpdateAlbumParams) (Album, error)
 	UpdateMedia(ctx context.Context, arg UpdateMediaParams) (UpdateMediaRow, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpsertLoginLockout(ctx context.Context, arg UpsertLoginLockoutParams) error
+	UpsertPermission(ctx context.Context, arg UpsertPermissionParams) error
 	UpsertSetting(ctx context.Context, arg UpsertSettingParams) (Setting, error)
+	UpsertUserTOTP(ctx context.Context, arg UpsertUserTOTPParams) error
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
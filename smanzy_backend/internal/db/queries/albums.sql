@@ -58,3 +58,7 @@ ON CONFLICT DO NOTHING;
 -- name: RemoveMediaFromAlbum :exec
 DELETE FROM album_media
 WHERE album_id = $1 AND media_id = $2;
+
+-- name: PurgeDeletedAlbums :execrows
+DELETE FROM album
+WHERE deleted_at < sqlc.arg(cutoff)::TIMESTAMPTZ;
@@ -0,0 +1,32 @@
+-- name: CreateAuditLogEntry :exec
+INSERT INTO audit_log (actor_id, impersonator_id, action, target_type, target_id, before, after, ip, user_agent)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: ListAuditLog :many
+-- Newest entries first. Zero and empty filters match everything; since and
+-- until are Unix milliseconds.
+SELECT
+    a.id, a.actor_id, actor.email AS actor_email, a.impersonator_id,
+    a.action, a.target_type, a.target_id, a.before, a.after,
+    a.ip, a.user_agent, a.created_at
+FROM audit_log a
+LEFT JOIN users actor ON actor.id = a.actor_id
+WHERE (sqlc.arg(actor_id)::BIGINT = 0 OR a.actor_id = sqlc.arg(actor_id))
+  AND (sqlc.arg(action)::TEXT = '' OR a.action = sqlc.arg(action))
+  AND (sqlc.arg(target_type)::TEXT = '' OR a.target_type = sqlc.arg(target_type))
+  AND (sqlc.arg(target_id)::TEXT = '' OR a.target_id = sqlc.arg(target_id))
+  AND (sqlc.arg(since)::BIGINT = 0 OR a.created_at >= sqlc.arg(since))
+  AND (sqlc.arg(until)::BIGINT = 0 OR a.created_at < sqlc.arg(until))
+ORDER BY a.created_at DESC, a.id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountAuditLog :one
+-- Counts the entries ListAuditLog matches
+SELECT COUNT(*)
+FROM audit_log a
+WHERE (sqlc.arg(actor_id)::BIGINT = 0 OR a.actor_id = sqlc.arg(actor_id))
+  AND (sqlc.arg(action)::TEXT = '' OR a.action = sqlc.arg(action))
+  AND (sqlc.arg(target_type)::TEXT = '' OR a.target_type = sqlc.arg(target_type))
+  AND (sqlc.arg(target_id)::TEXT = '' OR a.target_id = sqlc.arg(target_id))
+  AND (sqlc.arg(since)::BIGINT = 0 OR a.created_at >= sqlc.arg(since))
+  AND (sqlc.arg(until)::BIGINT = 0 OR a.created_at < sqlc.arg(until));
@@ -0,0 +1,9 @@
+-- name: CreateImpersonation :exec
+INSERT INTO impersonations (admin_id, user_id, jti, ip, user_agent, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ListUserImpersonations :many
+SELECT * FROM impersonations
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
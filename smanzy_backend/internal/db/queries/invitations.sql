@@ -0,0 +1,28 @@
+-- name: CreateInvitation :one
+INSERT INTO invitations (prefix, code_hash, role_id, created_by, max_uses, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: ListInvitations :many
+SELECT i.id, i.prefix, i.role_id, r.name AS role_name, i.created_by, i.max_uses, i.uses, i.expires_at, i.created_at
+FROM invitations i
+LEFT JOIN roles r ON r.id = i.role_id
+ORDER BY i.id DESC;
+
+-- name: RedeemInvitation :one
+UPDATE invitations
+SET uses = uses + 1
+WHERE code_hash = $1
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND (max_uses IS NULL OR uses < max_uses)
+RETURNING id, role_id;
+
+-- name: DeleteInvitation :one
+WITH deleted AS (
+    DELETE FROM invitations
+    WHERE id = $1
+    RETURNING id, prefix, role_id, created_by, max_uses, uses, expires_at, created_at
+)
+SELECT d.id, d.prefix, d.role_id, r.name AS role_name, d.created_by, d.max_uses, d.uses, d.expires_at, d.created_at
+FROM deleted d
+LEFT JOIN roles r ON r.id = d.role_id;
@@ -0,0 +1,63 @@
+-- name: LockLoginAttempts :exec
+-- Serializes attempts on an email and from an IP until the transaction ends.
+-- The email lock is always taken first, so concurrent attempts cannot deadlock.
+SELECT pg_advisory_xact_lock(hashtext('login_email:' || sqlc.arg(email)::TEXT)),
+       pg_advisory_xact_lock(hashtext('login_ip:' || sqlc.arg(ip)::TEXT));
+
+-- name: ReserveLoginAttempt :one
+-- Records an attempt before the password is checked. It counts as a failure
+-- until FinishLoginAttempt marks it as succeeded.
+INSERT INTO login_attempts (email, ip, succeeded)
+VALUES ($1, $2, FALSE)
+RETURNING id;
+
+-- name: FinishLoginAttempt :exec
+UPDATE login_attempts
+SET user_id = $2, succeeded = $3
+WHERE id = $1;
+
+-- name: GetAccountLoginFailures :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch'::timestamptz)::timestamptz AS last_failed_at
+FROM login_attempts
+WHERE email = $1 AND NOT succeeded AND NOT cleared AND created_at > $2;
+
+-- name: GetIPLoginFailures :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch'::timestamptz)::timestamptz AS last_failed_at
+FROM login_attempts
+WHERE ip = $1 AND NOT succeeded AND created_at > $2;
+
+-- name: ClearLoginFailures :exec
+UPDATE login_attempts
+SET cleared = TRUE
+WHERE email = $1 AND NOT succeeded AND NOT cleared;
+
+-- name: UpsertLoginLockout :exec
+INSERT INTO login_lockouts (email, locked_until)
+VALUES ($1, $2)
+ON CONFLICT (email) DO UPDATE
+SET locked_until = EXCLUDED.locked_until;
+
+-- name: GetLoginLockout :one
+SELECT locked_until FROM login_lockouts
+WHERE email = $1 AND locked_until > NOW();
+
+-- name: DeleteLoginLockout :exec
+DELETE FROM login_lockouts
+WHERE email = $1;
+
+-- name: ListUserLoginAttempts :many
+SELECT * FROM login_attempts
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: DeleteOldLoginAttempts :execrows
+-- Deletes attempts older than history_cutoff, and attempts on unknown emails,
+-- which are not in any login history, older than window_cutoff
+DELETE FROM login_attempts
+WHERE created_at < sqlc.arg(history_cutoff)::TIMESTAMPTZ
+   OR (user_id IS NULL AND created_at < sqlc.arg(window_cutoff)::TIMESTAMPTZ);
+
+-- name: DeleteExpiredLoginLockouts :execrows
+DELETE FROM login_lockouts
+WHERE locked_until <= NOW();
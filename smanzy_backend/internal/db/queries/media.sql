@@ -90,3 +90,12 @@ WHERE id = $1;
 -- name: PermanentlyDeleteMedia :exec
 DELETE FROM media
 WHERE id = $1;
+
+-- name: ListUserStoredNames :many
+SELECT stored_name FROM media
+WHERE user_id = $1;
+
+-- name: PurgeDeletedMedia :many
+DELETE FROM media
+WHERE deleted_at < sqlc.arg(cutoff)::TIMESTAMPTZ
+RETURNING id, stored_name;
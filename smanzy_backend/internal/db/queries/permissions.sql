@@ -0,0 +1,17 @@
+-- name: UpsertPermission :exec
+INSERT INTO permissions (name, description)
+VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description;
+
+-- name: GrantRolePermission :exec
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = sqlc.arg(role_name) AND p.name = sqlc.arg(permission_name)
+ON CONFLICT DO NOTHING;
+
+-- name: GetUserPermissions :many
+SELECT DISTINCT p.name FROM permissions p
+JOIN role_permissions rp ON rp.permission_id = p.id
+JOIN user_roles ur ON ur.role_id = rp.role_id
+WHERE ur.user_id = $1
+ORDER BY p.name;
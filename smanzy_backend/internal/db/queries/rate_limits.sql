@@ -0,0 +1,22 @@
+-- name: IncrementRateLimitCounter :one
+-- Adds count to the counter for key, starting a new window of period_ms when
+-- the current one has ended. The database clock is used so that all replicas
+-- agree on window boundaries.
+INSERT INTO rate_limit_counters (key, count, expires_at)
+VALUES (sqlc.arg(key), sqlc.arg(count), NOW() + sqlc.arg(period_ms)::BIGINT * INTERVAL '1 millisecond')
+ON CONFLICT (key) DO UPDATE
+SET count = CASE WHEN rate_limit_counters.expires_at <= NOW() THEN EXCLUDED.count ELSE rate_limit_counters.count + EXCLUDED.count END,
+    expires_at = CASE WHEN rate_limit_counters.expires_at <= NOW() THEN EXCLUDED.expires_at ELSE rate_limit_counters.expires_at END
+RETURNING count, expires_at;
+
+-- name: GetRateLimitCounter :one
+SELECT count, expires_at FROM rate_limit_counters
+WHERE key = $1 AND expires_at > NOW();
+
+-- name: DeleteRateLimitCounter :exec
+DELETE FROM rate_limit_counters
+WHERE key = $1;
+
+-- name: DeleteExpiredRateLimitCounters :execrows
+DELETE FROM rate_limit_counters
+WHERE expires_at <= NOW();
@@ -0,0 +1,28 @@
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (jti, family_id, user_id, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE jti = $1
+LIMIT 1;
+
+-- name: ConsumeRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE jti = $1 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: DeleteExpiredRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE expires_at <= NOW();
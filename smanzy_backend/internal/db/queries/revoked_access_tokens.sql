@@ -0,0 +1,15 @@
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (
+    SELECT 1 FROM revoked_access_tokens WHERE jti = $1
+) OR EXISTS (
+    SELECT 1 FROM user_sessions WHERE family_id = $2 AND revoked_at IS NOT NULL
+);
+
+-- name: DeleteExpiredRevokedAccessTokens :execrows
+DELETE FROM revoked_access_tokens
+WHERE expires_at <= NOW();
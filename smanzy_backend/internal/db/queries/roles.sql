@@ -0,0 +1,62 @@
+-- name: ListRoleSummaries :many
+SELECT
+    r.id, r.name, r.created_at, r.updated_at,
+    (SELECT COUNT(*) FROM user_roles ur WHERE ur.role_id = r.id) AS member_count,
+    COALESCE((
+        SELECT string_agg(p.name, ' ' ORDER BY p.name)
+        FROM role_permissions rp
+        JOIN permissions p ON p.id = rp.permission_id
+        WHERE rp.role_id = r.id
+    ), '')::TEXT AS permissions
+FROM roles r
+ORDER BY r.name;
+
+-- name: GetRoleSummary :one
+SELECT
+    r.id, r.name, r.created_at, r.updated_at,
+    (SELECT COUNT(*) FROM user_roles ur WHERE ur.role_id = r.id) AS member_count,
+    COALESCE((
+        SELECT string_agg(p.name, ' ' ORDER BY p.name)
+        FROM role_permissions rp
+        JOIN permissions p ON p.id = rp.permission_id
+        WHERE rp.role_id = r.id
+    ), '')::TEXT AS permissions
+FROM roles r
+WHERE r.id = $1
+LIMIT 1;
+
+-- name: RenameRole :exec
+UPDATE roles
+SET name = $2,
+    updated_at = (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+WHERE id = $1;
+
+-- name: DeleteRole :exec
+DELETE FROM roles
+WHERE id = $1;
+
+-- name: CountRoleMembers :one
+SELECT COUNT(*) FROM user_roles
+WHERE role_id = $1;
+
+-- name: ListRoleUsers :many
+SELECT
+    u.id, u.email, u.name,
+    COALESCE(u.tel, '') as tel,
+    COALESCE(u.age, 0) as age,
+    COALESCE(u.address, '') as address,
+    COALESCE(u.city, '') as city,
+    COALESCE(u.country, '') as country,
+    COALESCE(u.gender, '') as gender,
+    COALESCE(u.email_verified, false) as email_verified,
+    COALESCE(u.created_at, 0)::BIGINT as created_at,
+    COALESCE(u.updated_at, 0)::BIGINT as updated_at,
+    u.deleted_at
+FROM users u
+JOIN user_roles ur ON ur.user_id = u.id
+WHERE ur.role_id = $1
+ORDER BY u.id;
+
+-- name: ClearRolePermissions :exec
+DELETE FROM role_permissions
+WHERE role_id = $1;
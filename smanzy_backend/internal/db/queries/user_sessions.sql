@@ -0,0 +1,39 @@
+-- name: CreateUserSession :exec
+INSERT INTO user_sessions (family_id, user_id, ip, user_agent, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: TouchUserSession :exec
+UPDATE user_sessions
+SET ip = $2, user_agent = $3, expires_at = $4, last_used_at = NOW()
+WHERE family_id = $1;
+
+-- name: ListActiveUserSessions :many
+SELECT * FROM user_sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: ListUserSessions :many
+SELECT * FROM user_sessions
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: RevokeUserSession :execrows
+UPDATE user_sessions
+SET revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW();
+
+-- name: RevokeSession :exec
+UPDATE user_sessions
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeAllUserSessions :exec
+UPDATE user_sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: DeleteEndedUserSessions :execrows
+-- Deletes sessions that ended (were revoked or expired) before cutoff
+DELETE FROM user_sessions
+WHERE COALESCE(revoked_at, expires_at) < sqlc.arg(cutoff)::TIMESTAMPTZ;
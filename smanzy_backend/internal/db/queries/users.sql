@@ -10,7 +10,8 @@ SELECT
     COALESCE(email_verified, false) as email_verified,
     COALESCE(created_at, 0)::BIGINT as created_at, 
     COALESCE(updated_at, 0)::BIGINT as updated_at, 
-    deleted_at
+    deleted_at,
+    token_version
 FROM users
 WHERE email = $1 AND deleted_at IS NULL
 LIMIT 1;
@@ -44,27 +45,68 @@ SELECT
     COALESCE(email_verified, false) as email_verified,
     COALESCE(created_at, 0)::BIGINT as created_at, 
     COALESCE(updated_at, 0)::BIGINT as updated_at, 
-    deleted_at
+    deleted_at,
+    token_version
 FROM users
 WHERE id = $1 AND deleted_at IS NULL
 LIMIT 1;
 
--- name: ListUsers :many
-SELECT 
-    id, email, password, name, 
-    COALESCE(tel, '') as tel, 
-    COALESCE(age, 0) as age, 
-    COALESCE(address, '') as address, 
-    COALESCE(city, '') as city, 
-    COALESCE(country, '') as country, 
-    COALESCE(gender, '') as gender, 
-    COALESCE(email_verified, false) as email_verified,
-    COALESCE(created_at, 0)::BIGINT as created_at, 
-    COALESCE(updated_at, 0)::BIGINT as updated_at, 
-    deleted_at
-FROM users
-WHERE deleted_at IS NULL
-ORDER BY id;
+-- name: SearchUsers :many
+-- Admin user listing. Empty search and role match everyone; state is one of
+-- active, deleted or all. Search patterns are matched with ILIKE, so the
+-- caller escapes % and _.
+SELECT
+    u.id, u.email, u.name,
+    COALESCE(u.tel, '') AS tel,
+    COALESCE(u.age, 0) AS age,
+    COALESCE(u.address, '') AS address,
+    COALESCE(u.city, '') AS city,
+    COALESCE(u.country, '') AS country,
+    COALESCE(u.gender, '') AS gender,
+    COALESCE(u.email_verified, false) AS email_verified,
+    COALESCE(u.created_at, 0)::BIGINT AS created_at,
+    COALESCE(u.updated_at, 0)::BIGINT AS updated_at,
+    u.deleted_at,
+    (
+        SELECT COALESCE(json_agg(json_build_object('id', r.id, 'name', r.name) ORDER BY r.name), '[]')
+        FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = u.id
+    )::JSON AS roles
+FROM users u
+WHERE (sqlc.arg(search)::TEXT = '' OR u.email ILIKE '%' || sqlc.arg(search) || '%' OR u.name ILIKE '%' || sqlc.arg(search) || '%')
+  AND (sqlc.arg(role)::TEXT = '' OR EXISTS (
+      SELECT 1 FROM user_roles ur
+      JOIN roles r ON r.id = ur.role_id
+      WHERE ur.user_id = u.id AND r.name = sqlc.arg(role)
+  ))
+  AND (sqlc.arg(state)::TEXT = 'all'
+      OR (sqlc.arg(state) = 'active' AND u.deleted_at IS NULL)
+      OR (sqlc.arg(state) = 'deleted' AND u.deleted_at IS NOT NULL))
+ORDER BY
+    CASE WHEN sqlc.arg(sort)::TEXT = 'email' AND NOT sqlc.arg(descending)::BOOLEAN THEN lower(u.email) END,
+    CASE WHEN sqlc.arg(sort) = 'email' AND sqlc.arg(descending) THEN lower(u.email) END DESC,
+    CASE WHEN sqlc.arg(sort) = 'name' AND NOT sqlc.arg(descending) THEN lower(u.name) END,
+    CASE WHEN sqlc.arg(sort) = 'name' AND sqlc.arg(descending) THEN lower(u.name) END DESC,
+    CASE WHEN sqlc.arg(sort) = 'created_at' AND NOT sqlc.arg(descending) THEN u.created_at END,
+    CASE WHEN sqlc.arg(sort) = 'created_at' AND sqlc.arg(descending) THEN u.created_at END DESC,
+    CASE WHEN sqlc.arg(sort) = 'id' AND sqlc.arg(descending) THEN u.id END DESC,
+    u.id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountUsers :one
+-- Counts the users SearchUsers matches
+SELECT COUNT(*)
+FROM users u
+WHERE (sqlc.arg(search)::TEXT = '' OR u.email ILIKE '%' || sqlc.arg(search) || '%' OR u.name ILIKE '%' || sqlc.arg(search) || '%')
+  AND (sqlc.arg(role)::TEXT = '' OR EXISTS (
+      SELECT 1 FROM user_roles ur
+      JOIN roles r ON r.id = ur.role_id
+      WHERE ur.user_id = u.id AND r.name = sqlc.arg(role)
+  ))
+  AND (sqlc.arg(state)::TEXT = 'all'
+      OR (sqlc.arg(state) = 'active' AND u.deleted_at IS NULL)
+      OR (sqlc.arg(state) = 'deleted' AND u.deleted_at IS NOT NULL));
 
 -- name: CreateUser :one
 INSERT INTO users (
@@ -113,11 +155,63 @@ RETURNING
     COALESCE(updated_at, 0)::BIGINT as updated_at, 
     deleted_at;
 
+-- name: SetUserEmailVerified :exec
+UPDATE users
+SET email_verified = TRUE,
+    updated_at = (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2,
+    updated_at = (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+WHERE id = $1;
+
+-- name: RehashUserPassword :exec
+-- Replaces an outdated hash of the same password. Matching on the old hash
+-- keeps a concurrent password change from being overwritten.
+UPDATE users
+SET password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id) AND password = sqlc.arg(old_hash);
+
 -- name: SoftDeleteUser :exec
 UPDATE users
 SET deleted_at = NOW()
 WHERE id = $1;
 
+-- name: ScheduleUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = $2
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: CancelUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = NULL
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL;
+
+-- name: SoftDeleteScheduledUsers :many
+UPDATE users
+SET deleted_at = NOW(),
+    deletion_scheduled_at = NULL,
+    token_version = token_version + 1
+WHERE deletion_scheduled_at <= NOW() AND deleted_at IS NULL
+RETURNING id;
+
+-- name: ListPurgeableUsers :many
+SELECT id FROM users
+WHERE deleted_at < sqlc.arg(cutoff)::TIMESTAMPTZ
+ORDER BY id;
+
+-- name: PermanentlyDeleteUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version;
+
 -- name: RestoreUser :exec
 UPDATE users
 SET deleted_at = NULL
@@ -22,7 +22,9 @@ CREATE TABLE IF NOT EXISTS users (
     email_verified BOOLEAN DEFAULT FALSE,
     created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT,
     updated_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT,
-    deleted_at TIMESTAMP WITH TIME ZONE -- Soft delete
+    deleted_at TIMESTAMP WITH TIME ZONE, -- Soft delete
+    token_version BIGINT NOT NULL DEFAULT 0, -- Bumped to invalidate every token issued to the user
+    deletion_scheduled_at TIMESTAMP WITH TIME ZONE -- Self-requested deletion takes effect at this time
 );
 
 CREATE TABLE IF NOT EXISTS user_roles (
@@ -82,3 +84,177 @@ CREATE TABLE IF NOT EXISTS settings (
     created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT,
     updated_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
 );
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    jti TEXT UNIQUE NOT NULL,
+    family_id TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE, -- Set on rotation or family revocation
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL, -- SHA-256 of the token sent by email
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL, -- Base32 TOTP secret
+    enabled_at TIMESTAMP WITH TIME ZONE, -- NULL until enrollment is confirmed with a valid code
+    last_used_step BIGINT NOT NULL DEFAULT 0, -- Last accepted time step, prevents code replay
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL, -- SHA-256 of the recovery code
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT,
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL, -- Configured provider name (OIDC_PROVIDER_NAME)
+    subject TEXT NOT NULL, -- The provider's stable user identifier ("sub" claim)
+    email TEXT NOT NULL, -- Email reported by the provider when the link was made
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL, -- Leading characters of the key, shown to help tell keys apart
+    key_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the key
+    scopes TEXT NOT NULL, -- Space-separated scopes, e.g. "media:write videos:sync"
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL for keys that do not expire
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL, -- Normalized (lowercase) email as entered, also for unknown accounts
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE, -- NULL when no such account exists
+    ip TEXT NOT NULL,
+    succeeded BOOLEAN NOT NULL,
+    cleared BOOLEAN NOT NULL DEFAULT FALSE, -- Failures stop counting towards a lockout after a successful login or an unlock
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email_created_at ON login_attempts(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip_created_at ON login_attempts(ip, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user_id ON login_attempts(user_id);
+
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    email TEXT PRIMARY KEY, -- Normalized email of the locked account
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    family_id TEXT PRIMARY KEY, -- Refresh token family of the session
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL, -- Client IP at login, updated on every refresh
+    user_agent TEXT NOT NULL, -- Client User-Agent at login, updated on every refresh
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL, -- Expiry of the session's current refresh token
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP WITH TIME ZONE, -- Set on logout or revocation
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL, -- resource:action, e.g. media:delete:any
+    description TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_permissions_permission_id ON role_permissions(permission_id);
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS impersonations (
+    id BIGSERIAL PRIMARY KEY,
+    admin_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- NULL once the admin's account is purged
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    jti TEXT NOT NULL UNIQUE, -- ID of the impersonation access token
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations(user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonations_admin_id ON impersonations(admin_id);
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    prefix TEXT NOT NULL, -- Leading characters of the code, shown to help tell codes apart
+    code_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the code
+    role_id BIGINT REFERENCES roles(id) ON DELETE CASCADE, -- Granted on registration, in addition to the default role
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    max_uses INTEGER, -- NULL for unlimited
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL for codes that do not expire
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- NULL once the actor's account is purged
+    impersonator_id BIGINT REFERENCES users(id) ON DELETE SET NULL, -- Set when the actor was being impersonated
+    action TEXT NOT NULL, -- e.g. user.delete, setting.update
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL DEFAULT '', -- Empty for actions on many targets, such as an import
+    before JSONB NOT NULL DEFAULT '{}', -- Changed fields before the action
+    after JSONB NOT NULL DEFAULT '{}', -- Changed fields after the action
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at BIGINT NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key TEXT PRIMARY KEY, -- Policy and principal, e.g. "api:user:42" or "auth:ip:10.0.0.1"
+    count BIGINT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL -- End of the current window
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_expires_at ON rate_limit_counters(expires_at);
@@ -8,6 +8,8 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 )
 
 const assignRole = `-- name: AssignRole :exec
@@ -26,6 +28,45 @@ func (q *Queries) AssignRole(ctx context.Context, arg AssignRoleParams) error {
 	return err
 }
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = NULL
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*)
+FROM users u
+WHERE ($1::TEXT = '' OR u.email ILIKE '%' || $1 || '%' OR u.name ILIKE '%' || $1 || '%')
+  AND ($2::TEXT = '' OR EXISTS (
+      SELECT 1 FROM user_roles ur
+      JOIN roles r ON r.id = ur.role_id
+      WHERE ur.user_id = u.id AND r.name = $2
+  ))
+  AND ($3::TEXT = 'all'
+      OR ($3 = 'active' AND u.deleted_at IS NULL)
+      OR ($3 = 'deleted' AND u.deleted_at IS NOT NULL))
+`
+
+type CountUsersParams struct {
+	Search string `json:"search"`
+	Role   string `json:"role"`
+	State  string `json:"state"`
+}
+
+// Counts the users SearchUsers matches
+func (q *Queries) CountUsers(ctx context.Context, arg CountUsersParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers, arg.Search, arg.Role, arg.State)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createRole = `-- name: CreateRole :one
 INSERT INTO roles (name)
 VALUES ($1)
@@ -159,7 +200,8 @@ SELECT
     COALESCE(email_verified, false) as email_verified,
     COALESCE(created_at, 0)::BIGINT as created_at, 
     COALESCE(updated_at, 0)::BIGINT as updated_at, 
-    deleted_at
+    deleted_at,
+    token_version
 FROM users
 WHERE email = $1 AND deleted_at IS NULL
 LIMIT 1
@@ -180,6 +222,7 @@ type GetUserByEmailRow struct {
 	CreatedAt     int64        `json:"created_at"`
 	UpdatedAt     int64        `json:"updated_at"`
 	DeletedAt     sql.NullTime `json:"deleted_at"`
+	TokenVersion  int64        `json:"token_version"`
 }
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error) {
@@ -200,6 +243,7 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEm
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.TokenVersion,
 	)
 	return i, err
 }
@@ -273,7 +317,8 @@ SELECT
     COALESCE(email_verified, false) as email_verified,
     COALESCE(created_at, 0)::BIGINT as created_at, 
     COALESCE(updated_at, 0)::BIGINT as updated_at, 
-    deleted_at
+    deleted_at,
+    token_version
 FROM users
 WHERE id = $1 AND deleted_at IS NULL
 LIMIT 1
@@ -294,6 +339,7 @@ type GetUserByIDRow struct {
 	CreatedAt     int64        `json:"created_at"`
 	UpdatedAt     int64        `json:"updated_at"`
 	DeletedAt     sql.NullTime `json:"deleted_at"`
+	TokenVersion  int64        `json:"token_version"`
 }
 
 func (q *Queries) GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, error) {
@@ -314,6 +360,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, er
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.TokenVersion,
 	)
 	return i, err
 }
@@ -352,54 +399,214 @@ func (q *Queries) GetUserRoles(ctx context.Context, userID int64) ([]Role, error
 	return items, nil
 }
 
-const listUsers = `-- name: ListUsers :many
-SELECT 
-    id, email, password, name, 
-    COALESCE(tel, '') as tel, 
-    COALESCE(age, 0) as age, 
-    COALESCE(address, '') as address, 
-    COALESCE(city, '') as city, 
-    COALESCE(country, '') as country, 
-    COALESCE(gender, '') as gender, 
-    COALESCE(email_verified, false) as email_verified,
-    COALESCE(created_at, 0)::BIGINT as created_at, 
-    COALESCE(updated_at, 0)::BIGINT as updated_at, 
-    deleted_at
-FROM users
-WHERE deleted_at IS NULL
+const incrementUserTokenVersion = `-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) IncrementUserTokenVersion(ctx context.Context, id int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, incrementUserTokenVersion, id)
+	var token_version int64
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const listPurgeableUsers = `-- name: ListPurgeableUsers :many
+SELECT id FROM users
+WHERE deleted_at < $1::TIMESTAMPTZ
 ORDER BY id
 `
 
-type ListUsersRow struct {
-	ID            int64        `json:"id"`
-	Email         string       `json:"email"`
-	Password      string       `json:"password"`
-	Name          string       `json:"name"`
-	Tel           string       `json:"tel"`
-	Age           int64        `json:"age"`
-	Address       string       `json:"address"`
-	City          string       `json:"city"`
-	Country       string       `json:"country"`
-	Gender        string       `json:"gender"`
-	EmailVerified bool         `json:"email_verified"`
-	CreatedAt     int64        `json:"created_at"`
-	UpdatedAt     int64        `json:"updated_at"`
-	DeletedAt     sql.NullTime `json:"deleted_at"`
+func (q *Queries) ListPurgeableUsers(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, listPurgeableUsers, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const permanentlyDeleteUser = `-- name: PermanentlyDeleteUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) PermanentlyDeleteUser(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, permanentlyDeleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET password = $1
+WHERE id = $2 AND password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string `json:"new_hash"`
+	ID      int64  `json:"id"`
+	OldHash string `json:"old_hash"`
+}
+
+// Replaces an outdated hash of the same password. Matching on the old hash
+// keeps a concurrent password change from being overwritten.
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
+const removeRole = `-- name: RemoveRole :exec
+DELETE FROM user_roles
+WHERE user_id = $1 AND role_id = $2
+`
+
+type RemoveRoleParams struct {
+	UserID int64 `json:"user_id"`
+	RoleID int64 `json:"role_id"`
+}
+
+func (q *Queries) RemoveRole(ctx context.Context, arg RemoveRoleParams) error {
+	_, err := q.db.ExecContext(ctx, removeRole, arg.UserID, arg.RoleID)
+	return err
+}
+
+const restoreUser = `-- name: RestoreUser :exec
+UPDATE users
+SET deleted_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, restoreUser, id)
+	return err
 }
 
-func (q *Queries) ListUsers(ctx context.Context) ([]ListUsersRow, error) {
-	rows, err := q.db.QueryContext(ctx, listUsers)
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = $2
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  int64        `json:"id"`
+	DeletionScheduledAt sql.NullTime `json:"deletion_scheduled_at"`
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	return err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT
+    u.id, u.email, u.name,
+    COALESCE(u.tel, '') AS tel,
+    COALESCE(u.age, 0) AS age,
+    COALESCE(u.address, '') AS address,
+    COALESCE(u.city, '') AS city,
+    COALESCE(u.country, '') AS country,
+    COALESCE(u.gender, '') AS gender,
+    COALESCE(u.email_verified, false) AS email_verified,
+    COALESCE(u.created_at, 0)::BIGINT AS created_at,
+    COALESCE(u.updated_at, 0)::BIGINT AS updated_at,
+    u.deleted_at,
+    (
+        SELECT COALESCE(json_agg(json_build_object('id', r.id, 'name', r.name) ORDER BY r.name), '[]')
+        FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = u.id
+    )::JSON AS roles
+FROM users u
+WHERE ($1::TEXT = '' OR u.email ILIKE '%' || $1 || '%' OR u.name ILIKE '%' || $1 || '%')
+  AND ($2::TEXT = '' OR EXISTS (
+      SELECT 1 FROM user_roles ur
+      JOIN roles r ON r.id = ur.role_id
+      WHERE ur.user_id = u.id AND r.name = $2
+  ))
+  AND ($3::TEXT = 'all'
+      OR ($3 = 'active' AND u.deleted_at IS NULL)
+      OR ($3 = 'deleted' AND u.deleted_at IS NOT NULL))
+ORDER BY
+    CASE WHEN $4::TEXT = 'email' AND NOT $5::BOOLEAN THEN lower(u.email) END,
+    CASE WHEN $4 = 'email' AND $5 THEN lower(u.email) END DESC,
+    CASE WHEN $4 = 'name' AND NOT $5 THEN lower(u.name) END,
+    CASE WHEN $4 = 'name' AND $5 THEN lower(u.name) END DESC,
+    CASE WHEN $4 = 'created_at' AND NOT $5 THEN u.created_at END,
+    CASE WHEN $4 = 'created_at' AND $5 THEN u.created_at END DESC,
+    CASE WHEN $4 = 'id' AND $5 THEN u.id END DESC,
+    u.id
+LIMIT $6 OFFSET $7
+`
+
+type SearchUsersParams struct {
+	Search     string `json:"search"`
+	Role       string `json:"role"`
+	State      string `json:"state"`
+	Sort       string `json:"sort"`
+	Descending bool   `json:"descending"`
+	Limit      int32  `json:"limit"`
+	Offset     int32  `json:"offset"`
+}
+
+type SearchUsersRow struct {
+	ID            int64           `json:"id"`
+	Email         string          `json:"email"`
+	Name          string          `json:"name"`
+	Tel           string          `json:"tel"`
+	Age           int64           `json:"age"`
+	Address       string          `json:"address"`
+	City          string          `json:"city"`
+	Country       string          `json:"country"`
+	Gender        string          `json:"gender"`
+	EmailVerified bool            `json:"email_verified"`
+	CreatedAt     int64           `json:"created_at"`
+	UpdatedAt     int64           `json:"updated_at"`
+	DeletedAt     sql.NullTime    `json:"deleted_at"`
+	Roles         json.RawMessage `json:"roles"`
+}
+
+// Admin user listing. Empty search and role match everyone; state is one of
+// active, deleted or all. Search patterns are matched with ILIKE, so the
+// caller escapes % and _.
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers,
+		arg.Search,
+		arg.Role,
+		arg.State,
+		arg.Sort,
+		arg.Descending,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ListUsersRow
+	var items []SearchUsersRow
 	for rows.Next() {
-		var i ListUsersRow
+		var i SearchUsersRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Email,
-			&i.Password,
 			&i.Name,
 			&i.Tel,
 			&i.Age,
@@ -411,6 +618,7 @@ func (q *Queries) ListUsers(ctx context.Context) ([]ListUsersRow, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.Roles,
 		); err != nil {
 			return nil, err
 		}
@@ -425,30 +633,48 @@ func (q *Queries) ListUsers(ctx context.Context) ([]ListUsersRow, error) {
 	return items, nil
 }
 
-const removeRole = `-- name: RemoveRole :exec
-DELETE FROM user_roles
-WHERE user_id = $1 AND role_id = $2
+const setUserEmailVerified = `-- name: SetUserEmailVerified :exec
+UPDATE users
+SET email_verified = TRUE,
+    updated_at = (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+WHERE id = $1
 `
 
-type RemoveRoleParams struct {
-	UserID int64 `json:"user_id"`
-	RoleID int64 `json:"role_id"`
-}
-
-func (q *Queries) RemoveRole(ctx context.Context, arg RemoveRoleParams) error {
-	_, err := q.db.ExecContext(ctx, removeRole, arg.UserID, arg.RoleID)
+func (q *Queries) SetUserEmailVerified(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, setUserEmailVerified, id)
 	return err
 }
 
-const restoreUser = `-- name: RestoreUser :exec
+const softDeleteScheduledUsers = `-- name: SoftDeleteScheduledUsers :many
 UPDATE users
-SET deleted_at = NULL
-WHERE id = $1
+SET deleted_at = NOW(),
+    deletion_scheduled_at = NULL,
+    token_version = token_version + 1
+WHERE deletion_scheduled_at <= NOW() AND deleted_at IS NULL
+RETURNING id
 `
 
-func (q *Queries) RestoreUser(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, restoreUser, id)
-	return err
+func (q *Queries) SoftDeleteScheduledUsers(ctx context.Context) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, softDeleteScheduledUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const softDeleteUser = `-- name: SoftDeleteUser :exec
@@ -546,3 +772,20 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 	)
 	return i, err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password = $2,
+    updated_at = (EXTRACT(EPOCH FROM NOW()) * 1000)::BIGINT
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID       int64  `json:"id"`
+	Password string `json:"password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.Password)
+	return err
+}
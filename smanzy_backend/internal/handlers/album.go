@@ -194,10 +194,17 @@ func (ah *AlbumHandler) DeleteAlbumHandler(c *gin.Context) {
 		return
 	}
 
+	album, err := ah.albumService.GetAlbumByID(c.Request.Context(), uint(albumID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	if err := ah.albumService.DeleteAlbum(c.Request.Context(), uint(albumID)); err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
 		return
 	}
+	setAuditChanges(c, gin.H{"title": album.Title, "user_id": album.UserID}, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Album deleted successfully"})
 }
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/services"
+)
+
+// APIKeyHandler lets users manage their personal API keys
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateAPIKeyRequest is the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"` // Optional, RFC 3339
+}
+
+// ListAPIKeysHandler lists the current user's keys (without the keys themselves)
+func (kh *APIKeyHandler) ListAPIKeysHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	keys, err := kh.apiKeyService.List(c.Request.Context(), int64(userObj.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: keys})
+}
+
+// CreateAPIKeyHandler creates a key. The response is the only time the key is shown.
+func (kh *APIKeyHandler) CreateAPIKeyHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	created, err := kh.apiKeyService.Create(c.Request.Context(), int64(userObj.ID), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAPIKeyLimitReached):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "API key limit reached, revoke an unused key first"})
+		case errors.Is(err, services.ErrAPIKeyExpiryInPast):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Expiry must be in the future"})
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, SuccessResponse{Data: created})
+}
+
+// RevokeAPIKeyHandler deletes one of the current user's keys
+func (kh *APIKeyHandler) RevokeAPIKeyHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+
+	if err := kh.apiKeyService.Revoke(c.Request.Context(), int64(userObj.ID), keyID); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "API key revoked"}})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/services"
+)
+
+// Audit log listing limits
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// AuditHandler lets admins browse the audit log
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListAuditLogHandler returns one page of the audit log, newest first. Query
+// parameters: actor_id, action, target_type and target_id match exactly,
+// since and until are RFC 3339 times, page starts at 1 and limit is at most
+// maxAuditPageSize.
+func (ah *AuditHandler) ListAuditLogHandler(c *gin.Context) {
+	params, page, limit, err := parseAuditLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entries, total, err := ah.auditService.List(c.Request.Context(), params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: gin.H{
+		"entries": entries,
+		"pagination": Pagination{
+			Page:       page,
+			Limit:      limit,
+			Total:      total,
+			TotalPages: (total + int64(limit) - 1) / int64(limit),
+		},
+	}})
+}
+
+// parseAuditLogQuery reads and validates the audit log filters and pagination
+func parseAuditLogQuery(c *gin.Context) (db.ListAuditLogParams, int, int, error) {
+	params := db.ListAuditLogParams{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	if v := c.Query("actor_id"); v != "" {
+		actorID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || actorID < 1 {
+			return params, 0, 0, fmt.Errorf("invalid actor_id %q", v)
+		}
+		params.ActorID = actorID
+	}
+
+	for name, dst := range map[string]*int64{"since": &params.Since, "until": &params.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return params, 0, 0, fmt.Errorf("invalid %s %q, expected an RFC 3339 time", name, v)
+			}
+			*dst = t.UnixMilli()
+		}
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return params, 0, 0, fmt.Errorf("invalid page %q", c.Query("page"))
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditPageSize)))
+	if err != nil || limit < 1 || limit > maxAuditPageSize {
+		return params, 0, 0, fmt.Errorf("invalid limit %q, expected 1-%d", c.Query("limit"), maxAuditPageSize)
+	}
+
+	params.Limit = int32(limit)
+	params.Offset = int32((page - 1) * limit)
+	return params, page, limit, nil
+}
+
+// setAuditChanges tells the Audit middleware that the action's change has
+// been committed and what it changed, so it is recorded even if the request
+// fails afterwards. before and after are snapshots of the target; see
+// services.NewAuditChanges.
+func setAuditChanges(c *gin.Context, before, after any) {
+	changes, err := services.NewAuditChanges(before, after)
+	if err != nil {
+		log.Printf("Failed to compute audit changes: %v", err)
+		changes = services.AuditChanges{}
+	}
+	c.Set("audit_changes", changes)
+}
@@ -2,31 +2,66 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ristep/smanzy_backend/internal/auth"
 	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mappers"
 	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/services"
 )
 
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
-	conn       *sql.DB
-	queries    *db.Queries
-	jwtService *auth.JWTService
+	conn                *sql.DB
+	queries             *db.Queries
+	jwtService          *auth.JWTService
+	sessionService      *services.SessionService
+	verificationService *services.EmailVerificationService
+	resetService        *services.PasswordResetService
+	twoFactorService    *services.TwoFactorService
+	loginThrottle       *services.LoginThrottleService
+	accountDeletion     *services.AccountDeletionService
+	dataExport          *services.DataExportService
+	passwordHasher      *auth.PasswordHasher
+	cookies             *auth.SessionCookies // nil unless cookie mode is on
+	// dummyPasswordHash is verified against when the email is unknown, so a
+	// failed login takes as long whether or not the account exists
+	dummyPasswordHash func() string
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(conn *sql.DB, queries *db.Queries, jwtService *auth.JWTService) *AuthHandler {
+func NewAuthHandler(conn *sql.DB, queries *db.Queries, jwtService *auth.JWTService, sessionService *services.SessionService, verificationService *services.EmailVerificationService, resetService *services.PasswordResetService, twoFactorService *services.TwoFactorService, loginThrottle *services.LoginThrottleService, accountDeletion *services.AccountDeletionService, dataExport *services.DataExportService, passwordHasher *auth.PasswordHasher, cookies *auth.SessionCookies) *AuthHandler {
 	return &AuthHandler{
-		conn:       conn,
-		queries:    queries,
-		jwtService: jwtService,
+		conn:                conn,
+		queries:             queries,
+		jwtService:          jwtService,
+		sessionService:      sessionService,
+		verificationService: verificationService,
+		resetService:        resetService,
+		twoFactorService:    twoFactorService,
+		loginThrottle:       loginThrottle,
+		accountDeletion:     accountDeletion,
+		dataExport:          dataExport,
+		passwordHasher:      passwordHasher,
+		cookies:             cookies,
+		dummyPasswordHash: sync.OnceValue(func() string {
+			hash, _ := passwordHasher.Hash("not-a-real-password")
+			return hash
+		}),
 	}
 }
 
@@ -41,6 +76,8 @@ type RegisterRequest struct {
 	Address  string `json:"address"`
 	City     string `json:"city"`
 	Country  string `json:"country"`
+	// InvitationCode is required when registration is invite-only
+	InvitationCode string `json:"invitation_code"`
 }
 
 // LoginRequest represents the JSON payload for login
@@ -49,9 +86,59 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// RefreshRequest represents the JSON payload for refresh token
+// VerifyEmailRequest represents the JSON payload for email verification
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest represents the JSON payload for resending the verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPasswordRequest represents the JSON payload for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ChangePasswordRequest represents the JSON payload for changing the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ResetPasswordTokenRequest represents the JSON payload for resetting a password with an emailed token
+type ResetPasswordTokenRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// TwoFactorVerifyRequest represents the JSON payload for completing a 2FA login
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // TOTP code or recovery code
+}
+
+// TwoFactorCodeRequest represents the JSON payload for confirming 2FA enrollment
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest represents the JSON payload for turning 2FA off
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP code or recovery code
+}
+
+// DeleteProfileRequest represents the JSON payload for deleting the current user's account
+type DeleteProfileRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// RefreshRequest represents the JSON payload for refresh token. In cookie
+// mode the body may be empty; the refresh token cookie is used instead.
 type RefreshRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 // SuccessResponse represents a successful API response
@@ -74,8 +161,23 @@ func (ah *AuthHandler) RegisterHandler(c *gin.Context) {
 		return
 	}
 
+	// Enforce the registration mode
+	mode, err := services.RegistrationMode(c.Request.Context(), ah.queries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+	switch {
+	case mode == services.RegistrationClosed:
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Registration is closed"})
+		return
+	case mode == services.RegistrationInviteOnly && req.InvitationCode == "":
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "An invitation code is required to register"})
+		return
+	}
+
 	// Check if user already exists
-	_, err := ah.queries.GetUserByEmail(c.Request.Context(), req.Email)
+	_, err = ah.queries.GetUserByEmail(c.Request.Context(), req.Email)
 	if err == nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "User already exists"})
 		return
@@ -84,8 +186,14 @@ func (ah *AuthHandler) RegisterHandler(c *gin.Context) {
 		return
 	}
 
+	// Enforce the password policy
+	if err := auth.ValidatePassword(req.Password, req.Email); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := ah.passwordHasher.Hash(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to process password"})
 		return
@@ -106,10 +214,33 @@ func (ah *AuthHandler) RegisterHandler(c *gin.Context) {
 		}
 	}
 
+	tx, err := ah.conn.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := ah.queries.WithTx(tx)
+
+	// Use up the invitation, if any; it is given back if registration fails
+	var invitedRoleID sql.NullInt64
+	if req.InvitationCode != "" {
+		invitedRoleID, err = services.RedeemInvitation(c.Request.Context(), qtx, req.InvitationCode)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidInvitation) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invitation code is invalid, expired or used up"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+			return
+		}
+	}
+
 	// Create the new user
-	newUserRow, err := ah.queries.CreateUser(c.Request.Context(), db.CreateUserParams{
+	newUserRow, err := qtx.CreateUser(c.Request.Context(), db.CreateUserParams{
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Name:     req.Name,
 		Tel:      sql.NullString{String: req.Tel, Valid: req.Tel != ""},
 		Age:      sql.NullInt64{Int64: int64(req.Age), Valid: req.Age != 0},
@@ -124,13 +255,24 @@ func (ah *AuthHandler) RegisterHandler(c *gin.Context) {
 		return
 	}
 
-	// Assign the role
-	err = ah.queries.AssignRole(c.Request.Context(), db.AssignRoleParams{
-		UserID: newUserRow.ID,
-		RoleID: userRole.ID,
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to assign role"})
+	// Assign the default role and the one the invitation carries
+	roleIDs := []int64{userRole.ID}
+	if invitedRoleID.Valid && invitedRoleID.Int64 != userRole.ID {
+		roleIDs = append(roleIDs, invitedRoleID.Int64)
+	}
+	for _, roleID := range roleIDs {
+		err = qtx.AssignRole(c.Request.Context(), db.AssignRoleParams{
+			UserID: newUserRow.ID,
+			RoleID: roleID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to assign role"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create user"})
 		return
 	}
 
@@ -163,18 +305,41 @@ func (ah *AuthHandler) RegisterHandler(c *gin.Context) {
 		})
 	}
 
-	// Generate tokens
-	tokenPair, err := ah.jwtService.GenerateTokenPair(&apiUser)
+	// Send the verification link; registration succeeds even if mail delivery fails
+	if err := ah.verificationService.SendVerification(c.Request.Context(), &apiUser); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", apiUser.Email, err)
+	}
+
+	// When unverified users may not log in, don't hand out tokens yet
+	policy, err := ah.verificationService.UnverifiedAccess(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+	if policy == services.UnverifiedAccessNoLogin {
+		c.JSON(http.StatusCreated, SuccessResponse{Data: map[string]interface{}{
+			"user":    apiUser,
+			"message": "Please verify your email address before logging in",
+		}})
+		return
+	}
+
+	// Generate tokens (starts a new refresh token family)
+	tokenPair, err := ah.sessionService.IssueTokenPair(c.Request.Context(), &apiUser, false, sessionClient(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, SuccessResponse{Data: map[string]interface{}{
-		"user":          apiUser,
-		"access_token":  tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
-	}})
+	data := map[string]interface{}{
+		"user": apiUser,
+	}
+	if err := ah.writeTokens(c, data, tokenPair, true); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse{Data: data})
 }
 
 // LoginHandler handles user login
@@ -187,23 +352,69 @@ func (ah *AuthHandler) LoginHandler(c *gin.Context) {
 		return
 	}
 
-	// Find user by email
-	userRow, err := ah.queries.GetUserByEmail(c.Request.Context(), req.Email)
+	// Refuse attempts that come too soon after failures or target a locked
+	// account, and count this one before checking the password. Unknown
+	// emails are throttled the same way.
+	attemptID, err := ah.loginThrottle.Reserve(c.Request.Context(), req.Email, c.ClientIP())
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid email or password"})
+		var throttled *services.LoginThrottledError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many login attempts. Try again later."})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
 		return
 	}
 
-	// Compare passwords
-	if err := bcrypt.CompareHashAndPassword([]byte(userRow.Password), []byte(req.Password)); err != nil {
+	// Find user by email
+	userRow, err := ah.queries.GetUserByEmail(c.Request.Context(), req.Email)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	// Compare passwords (against a dummy hash for unknown emails and
+	// accounts without a password)
+	found := err == nil && userRow.Password != auth.UnusablePassword
+	passwordHash := ah.dummyPasswordHash()
+	if found {
+		passwordHash = userRow.Password
+	}
+	match, rehash, err := ah.passwordHasher.Verify(req.Password, passwordHash)
+	if err != nil || !match || !found {
+		if err := ah.loginThrottle.RecordFailure(c.Request.Context(), attemptID, req.Email, userRow.ID); err != nil {
+			log.Printf("Failed to record login attempt: %v", err)
+		}
 		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid email or password"})
 		return
 	}
 
+	if err := ah.loginThrottle.RecordSuccess(c.Request.Context(), attemptID, req.Email, userRow.ID); err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+
+	// Upgrade hashes made with another algorithm or outdated parameters while
+	// the password is at hand; the login succeeds either way
+	if rehash {
+		if err := ah.rehashPassword(c, userRow.ID, req.Password, userRow.Password); err != nil {
+			log.Printf("Failed to rehash password of user %d: %v", userRow.ID, err)
+		}
+	}
+
+	// Enforce the unverified email policy
+	if !userRow.EmailVerified {
+		policy, err := ah.verificationService.UnverifiedAccess(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+			return
+		}
+		if policy == services.UnverifiedAccessNoLogin {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Email address not verified"})
+			return
+		}
+	}
+
 	// Fetch roles
 	roles, err := ah.queries.GetUserRoles(c.Request.Context(), userRow.ID)
 	if err != nil {
@@ -225,6 +436,7 @@ func (ah *AuthHandler) LoginHandler(c *gin.Context) {
 		EmailVerified: userRow.EmailVerified,
 		CreatedAt:     userRow.CreatedAt,
 		UpdatedAt:     userRow.UpdatedAt,
+		TokenVersion:  userRow.TokenVersion,
 	}
 	for _, r := range roles {
 		apiUser.Roles = append(apiUser.Roles, models.Role{
@@ -233,70 +445,147 @@ func (ah *AuthHandler) LoginHandler(c *gin.Context) {
 		})
 	}
 
-	// Generate tokens
-	tokenPair, err := ah.jwtService.GenerateTokenPair(&apiUser)
+	// Accounts with 2FA get a short-lived challenge instead of tokens; it is
+	// exchanged together with a code at /api/auth/2fa/verify
+	twoFactorEnabled, err := ah.twoFactorService.IsEnabled(c.Request.Context(), userRow.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+	if twoFactorEnabled {
+		challenge, err := ah.jwtService.GeneratePurposeToken(&apiUser, auth.TokenTypeTwoFactorChallenge, services.TwoFactorChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Data: map[string]interface{}{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		}})
+		return
+	}
+
+	// Generate tokens (starts a new refresh token family)
+	tokenPair, err := ah.sessionService.IssueTokenPair(c.Request.Context(), &apiUser, false, sessionClient(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]interface{}{
-		"user":          apiUser,
-		"access_token":  tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
-	}})
+	data := map[string]interface{}{
+		"user": apiUser,
+	}
+	if err := ah.writeTokens(c, data, tokenPair, true); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: data})
 }
 
-// RefreshHandler handles token refresh
+// RefreshHandler handles token refresh. The refresh token is read from the
+// body, or in cookie mode from the refresh token cookie, in which case the
+// request must carry the CSRF token like any other cookie-authenticated one.
 func (ah *AuthHandler) RefreshHandler(c *gin.Context) {
 	var req RefreshRequest
 
-	// Validate JSON input
+	// Validate JSON input; cookie-mode clients may send no body at all
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	if req.RefreshToken == "" && ah.cookies != nil {
+		if cookie, err := c.Cookie(auth.RefreshTokenCookie); err == nil {
+			if !auth.ValidCSRF(c.Request) {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: "Missing or invalid CSRF token"})
+				return
+			}
+			req.RefreshToken = cookie
+		}
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	// Rotate the refresh token: the presented token is consumed and a new pair
+	// is issued in the same family. Replaying an old token revokes the family.
+	tokenPair, err := ah.sessionService.RotateRefreshToken(c.Request.Context(), req.RefreshToken, sessionClient(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			ah.clearCookies(c)
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Refresh token reuse detected, session revoked"})
+		case errors.Is(err, services.ErrInvalidRefreshToken):
+			ah.clearCookies(c)
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to refresh tokens"})
+		}
+		return
+	}
+
+	data := map[string]interface{}{}
+	if err := ah.writeTokens(c, data, tokenPair, false); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: data})
+}
+
+// VerifyTwoFactorHandler completes a 2FA login: the challenge token from
+// LoginHandler plus a TOTP or recovery code are exchanged for a token pair
+func (ah *AuthHandler) VerifyTwoFactorHandler(c *gin.Context) {
+	var req TwoFactorVerifyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
 		return
 	}
 
-	// Validate the refresh token
-	claims, err := ah.jwtService.ValidateRefreshToken(req.RefreshToken)
+	claims, err := ah.jwtService.ValidateToken(req.ChallengeToken, auth.TokenTypeTwoFactorChallenge)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid refresh token"})
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired login challenge"})
 		return
 	}
 
-	// Fetch the user from the database
 	userRow, err := ah.queries.GetUserByID(c.Request.Context(), int64(claims.UserID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not found"})
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired login challenge"})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
 		return
 	}
 
-	// Fetch roles
+	// A logout-everywhere since the password step invalidates the challenge
+	if claims.Version != userRow.TokenVersion {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired login challenge"})
+		return
+	}
+
+	if err := ah.twoFactorService.Verify(c.Request.Context(), userRow.ID, req.Code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrTwoFactorNotEnrolled):
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid two-factor code"})
+		case errors.Is(err, services.ErrTwoFactorRateLimited):
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many attempts. Try again later."})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify code"})
+		}
+		return
+	}
+
 	roles, err := ah.queries.GetUserRoles(c.Request.Context(), userRow.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch roles"})
 		return
 	}
 
-	// Map to models.User (DTO)
-	apiUser := models.User{
-		ID:            uint(userRow.ID),
-		Email:         userRow.Email,
-		Name:          userRow.Name,
-		Tel:           userRow.Tel,
-		Age:           int(userRow.Age),
-		Gender:        userRow.Gender,
-		Address:       userRow.Address,
-		City:          userRow.City,
-		Country:       userRow.Country,
-		EmailVerified: userRow.EmailVerified,
-		CreatedAt:     userRow.CreatedAt,
-		UpdatedAt:     userRow.UpdatedAt,
-	}
+	apiUser := mappers.UserRowToModel(userRow)
 	for _, r := range roles {
 		apiUser.Roles = append(apiUser.Roles, models.Role{
 			ID:   uint(r.ID),
@@ -304,19 +593,442 @@ func (ah *AuthHandler) RefreshHandler(c *gin.Context) {
 		})
 	}
 
-	// Generate a new token pair
-	tokenPair, err := ah.jwtService.GenerateTokenPair(&apiUser)
+	tokenPair, err := ah.sessionService.IssueTokenPair(c.Request.Context(), &apiUser, true, sessionClient(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
 		return
 	}
 
+	data := map[string]interface{}{
+		"user": apiUser,
+	}
+	if err := ah.writeTokens(c, data, tokenPair, true); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: data})
+}
+
+// JWKSHandler publishes the public keys tokens are verified with, so other
+// services can validate tokens without holding a signing secret
+func (ah *AuthHandler) JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, ah.jwtService.JWKS())
+}
+
+// VerifyEmailHandler confirms a user's email address from a verification link
+func (ah *AuthHandler) VerifyEmailHandler(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	if err := ah.verificationService.Verify(c.Request.Context(), req.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired verification link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Email verified successfully"}})
+}
+
+// ResendVerificationHandler sends a new verification link. The response is
+// the same whether or not the address belongs to an account.
+func (ah *AuthHandler) ResendVerificationHandler(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	if err := ah.verificationService.Resend(c.Request.Context(), req.Email); err != nil {
+		if errors.Is(err, services.ErrVerificationRateLimited) {
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many verification emails requested. Try again later."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "If the address belongs to an unverified account, a verification email has been sent"}})
+}
+
+// ForgotPasswordHandler emails a single-use password reset link. The response
+// is the same whether or not the address belongs to an account.
+func (ah *AuthHandler) ForgotPasswordHandler(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	if err := ah.resetService.RequestReset(c.Request.Context(), req.Email); err != nil {
+		if errors.Is(err, services.ErrResetRateLimited) {
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many password reset emails requested. Try again later."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request password reset"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "If the address belongs to an account, a password reset email has been sent"}})
+}
+
+// ResetPasswordHandler sets a new password using an emailed reset token and
+// revokes every existing session of the user
+func (ah *AuthHandler) ResetPasswordHandler(c *gin.Context) {
+	var req ResetPasswordTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	if err := ah.resetService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: policyErr.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired reset link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Password reset successfully. Please log in again."}})
+}
+
+// LogoutHandler ends the current session: the presented access token is
+// denylisted and its refresh token family is revoked
+func (ah *AuthHandler) LogoutHandler(c *gin.Context) {
+	claimsVal, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	claims := claimsVal.(*auth.CustomClaims)
+
+	if err := ah.sessionService.Logout(c.Request.Context(), claims); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out"})
+		return
+	}
+
+	ah.clearCookies(c)
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Logged out successfully"}})
+}
+
+// LogoutAllHandler ends every session of the current user
+func (ah *AuthHandler) LogoutAllHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	if err := ah.sessionService.RevokeAllSessions(c.Request.Context(), int64(userObj.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log out"})
+		return
+	}
+
+	ah.clearCookies(c)
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Logged out of all sessions"}})
+}
+
+// ListSessionsHandler lists the current user's active sessions
+func (ah *AuthHandler) ListSessionsHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	rows, err := ah.sessionService.ListSessions(c.Request.Context(), int64(userObj.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list sessions"})
+		return
+	}
+
+	var currentFamilyID string
+	if claims, ok := c.Get("claims"); ok {
+		currentFamilyID = claims.(*auth.CustomClaims).FamilyID
+	}
+
+	sessions := make([]models.Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, mappers.SessionRowToModel(row, currentFamilyID))
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: sessions})
+}
+
+// RevokeSessionHandler ends one of the current user's sessions
+func (ah *AuthHandler) RevokeSessionHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	err := ah.sessionService.RevokeSession(c.Request.Context(), int64(userObj.ID), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Session revoked"}})
+}
+
+// TwoFactorStatusHandler reports the current user's 2FA state
+func (ah *AuthHandler) TwoFactorStatusHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	enabled, err := ah.twoFactorService.IsEnabled(c.Request.Context(), int64(userObj.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	required, err := services.RequiresTwoFactor(c.Request.Context(), ah.queries, userObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	var remaining int64
+	if enabled {
+		remaining, err = ah.twoFactorService.RemainingRecoveryCodes(c.Request.Context(), int64(userObj.ID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]interface{}{
-		"access_token":  tokenPair.AccessToken,
-		"refresh_token": tokenPair.RefreshToken,
+		"enabled":                  enabled,
+		"required":                 required,
+		"recovery_codes_remaining": remaining,
 	}})
 }
 
+// EnrollTwoFactorHandler starts TOTP enrollment and returns the provisioning
+// URI and recovery codes. 2FA stays off until the enrollment is confirmed.
+func (ah *AuthHandler) EnrollTwoFactorHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	enrollment, err := ah.twoFactorService.BeginEnrollment(c.Request.Context(), userObj)
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Two-factor authentication is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: enrollment})
+}
+
+// ConfirmTwoFactorHandler enables 2FA once the user proves the authenticator
+// app works. The caller gets a fresh token pair marked as 2FA-authenticated.
+func (ah *AuthHandler) ConfirmTwoFactorHandler(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	if err := ah.twoFactorService.ConfirmEnrollment(c.Request.Context(), int64(userObj.ID), req.Code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidTwoFactorCode):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid two-factor code"})
+		case errors.Is(err, services.ErrTwoFactorNotEnrolled):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Start enrollment first"})
+		case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Two-factor authentication is already enabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to enable two-factor authentication"})
+		}
+		return
+	}
+
+	tokenPair, err := ah.sessionService.IssueTokenPair(c.Request.Context(), userObj, true, sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	data := map[string]interface{}{
+		"message": "Two-factor authentication enabled",
+	}
+	if err := ah.writeTokens(c, data, tokenPair, false); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: data})
+}
+
+// DisableTwoFactorHandler turns 2FA off after checking the password and a
+// current code
+func (ah *AuthHandler) DisableTwoFactorHandler(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	userRow, err := ah.queries.GetUserByID(c.Request.Context(), int64(userObj.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	if match, _, err := ah.passwordHasher.Verify(req.Password, userRow.Password); err != nil || !match {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Password is incorrect"})
+		return
+	}
+
+	if err := ah.twoFactorService.Verify(c.Request.Context(), userRow.ID, req.Code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidTwoFactorCode):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid two-factor code"})
+		case errors.Is(err, services.ErrTwoFactorNotEnrolled):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Two-factor authentication is not enabled"})
+		case errors.Is(err, services.ErrTwoFactorRateLimited):
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many attempts. Try again later."})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify code"})
+		}
+		return
+	}
+
+	if err := ah.twoFactorService.Disable(c.Request.Context(), userRow.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Two-factor authentication disabled"}})
+}
+
+// sessionUsedMFA reports whether the current request's session was
+// established with a second factor
+func sessionUsedMFA(c *gin.Context) bool {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return false
+	}
+	customClaims, ok := claims.(*auth.CustomClaims)
+	return ok && customClaims.MFA
+}
+
+// writeTokens hands a new token pair to the client by adding it to the
+// response data. In cookie mode the tokens are set as HttpOnly cookies and
+// only the CSRF token is returned; rotateCSRF replaces the browser's CSRF
+// token, which every new login does.
+func (ah *AuthHandler) writeTokens(c *gin.Context, data map[string]interface{}, pair *auth.TokenPair, rotateCSRF bool) error {
+	if ah.cookies == nil {
+		data["access_token"] = pair.AccessToken
+		data["refresh_token"] = pair.RefreshToken
+		return nil
+	}
+
+	csrfToken, err := c.Cookie(auth.CSRFCookie)
+	if rotateCSRF || err != nil || csrfToken == "" {
+		if csrfToken, err = auth.NewCSRFToken(); err != nil {
+			return err
+		}
+	}
+
+	ah.cookies.Set(c.Writer, pair, csrfToken)
+	data["csrf_token"] = csrfToken
+	return nil
+}
+
+// clearCookies removes the session cookies, if cookie mode is on
+func (ah *AuthHandler) clearCookies(c *gin.Context) {
+	if ah.cookies != nil {
+		ah.cookies.Clear(c.Writer)
+	}
+}
+
+// CSRFTokenHandler returns the CSRF token of a cookie-mode session, issuing
+// one if the browser has none, so an SPA that lost it from memory (e.g. after
+// a page reload) can keep making state-changing requests
+func (ah *AuthHandler) CSRFTokenHandler(c *gin.Context) {
+	csrfToken, err := c.Cookie(auth.CSRFCookie)
+	if err != nil || csrfToken == "" {
+		if csrfToken, err = auth.NewCSRFToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate CSRF token"})
+			return
+		}
+		ah.cookies.SetCSRF(c.Writer, csrfToken)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"csrf_token": csrfToken}})
+}
+
+// rehashPassword replaces the user's stored hash with one made by the current
+// hasher settings, unless the password changed in the meantime
+func (ah *AuthHandler) rehashPassword(c *gin.Context, userID int64, password, oldHash string) error {
+	newHash, err := ah.passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return ah.queries.RehashUserPassword(c.Request.Context(), db.RehashUserPasswordParams{
+		NewHash: newHash,
+		ID:      userID,
+		OldHash: oldHash,
+	})
+}
+
+// sessionClient describes the client of the current request for session tracking
+func sessionClient(c *gin.Context) services.SessionClient {
+	return services.SessionClient{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
 // ProfileHandler returns the current user's profile
 func (ah *AuthHandler) ProfileHandler(c *gin.Context) {
 	// Get user from context (set by middleware)
@@ -421,11 +1133,111 @@ func (ah *AuthHandler) UpdateProfileHandler(c *gin.Context) {
 	userObj.Gender = updatedRow.Gender
 	userObj.UpdatedAt = updatedRow.UpdatedAt
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: userObj})
+	c.JSON(http.StatusOK, SuccessResponse{Data: userObj})
+}
+
+// ChangePasswordHandler changes the current user's password after checking
+// the current one. Every other session is revoked and the caller receives a
+// fresh token pair.
+func (ah *AuthHandler) ChangePasswordHandler(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	// Load the stored hash (not kept on the context user)
+	userRow, err := ah.queries.GetUserByID(c.Request.Context(), int64(userObj.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	if match, _, err := ah.passwordHasher.Verify(req.CurrentPassword, userRow.Password); err != nil || !match {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Current password is incorrect"})
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "New password must differ from the current password"})
+		return
+	}
+
+	if err := auth.ValidatePassword(req.NewPassword, userRow.Email); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	hashedPassword, err := ah.passwordHasher.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to process password"})
+		return
+	}
+
+	tx, err := ah.conn.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := ah.queries.WithTx(tx)
+
+	err = qtx.UpdateUserPassword(c.Request.Context(), db.UpdateUserPasswordParams{
+		ID:       userRow.ID,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+
+	// Log out everywhere, then start a new session for this client
+	if err := ah.sessionService.RevokeAllSessionsTx(c.Request.Context(), qtx, userRow.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+
+	userObj.TokenVersion++
+	tokenPair, err := ah.sessionService.IssueTokenPair(c.Request.Context(), userObj, sessionUsedMFA(c), sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	data := map[string]interface{}{
+		"message": "Password changed successfully",
+	}
+	if err := ah.writeTokens(c, data, tokenPair, false); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: data})
 }
 
-// DeleteProfileHandler deletes the current user's profile
+// DeleteProfileHandler schedules the deletion of the current user's account.
+// The user is logged out everywhere; signing in again before the grace
+// period ends cancels the deletion.
 func (ah *AuthHandler) DeleteProfileHandler(c *gin.Context) {
+	var req DeleteProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Password is required"})
+		return
+	}
+
 	// Get user from context
 	user, exists := c.Get("user")
 	if !exists {
@@ -435,119 +1247,182 @@ func (ah *AuthHandler) DeleteProfileHandler(c *gin.Context) {
 
 	userObj := user.(*models.User)
 
-	// In Pure SQL, we handle the soft delete
-	err := ah.queries.SoftDeleteUser(c.Request.Context(), int64(userObj.ID))
+	// Load the stored hash (not kept on the context user)
+	userRow, err := ah.queries.GetUserByID(c.Request.Context(), int64(userObj.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	if match, _, err := ah.passwordHasher.Verify(req.Password, userRow.Password); err != nil || !match {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Password is incorrect"})
+		return
+	}
+
+	deleteAt, err := ah.accountDeletion.Schedule(c.Request.Context(), userRow.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete profile"})
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Profile deleted successfully"}})
+	ah.clearCookies(c)
+	c.JSON(http.StatusAccepted, SuccessResponse{Data: gin.H{
+		"message":               "Account scheduled for deletion. Sign in again before then to cancel.",
+		"deletion_scheduled_at": deleteAt,
+	}})
+}
+
+// ExportProfileHandler streams a ZIP archive of the current user's profile,
+// albums, media metadata and original media files
+func (ah *AuthHandler) ExportProfileHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	filename := fmt.Sprintf("smanzy-export-%d-%s.zip", userObj.ID, time.Now().UTC().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	// Headers are already sent; a failure can only cut the archive short
+	if err := ah.dataExport.WriteZIP(c.Request.Context(), userObj, c.Writer); err != nil {
+		log.Printf("Data export for user %d failed: %v", userObj.ID, err)
+		c.Abort()
+	}
 }
 
 // UserHandler represents handlers for user management
 type UserHandler struct {
-	conn    *sql.DB
-	queries *db.Queries
+	conn           *sql.DB
+	queries        *db.Queries
+	sessionService *services.SessionService
+	loginThrottle  *services.LoginThrottleService
+	impersonation  *services.ImpersonationService
+	passwordHasher *auth.PasswordHasher
+	userCSV        *services.UserCSVService
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(conn *sql.DB, queries *db.Queries) *UserHandler {
+func NewUserHandler(conn *sql.DB, queries *db.Queries, sessionService *services.SessionService, loginThrottle *services.LoginThrottleService, impersonation *services.ImpersonationService, passwordHasher *auth.PasswordHasher, userCSV *services.UserCSVService) *UserHandler {
 	return &UserHandler{
-		conn:    conn,
-		queries: queries,
+		conn:           conn,
+		queries:        queries,
+		sessionService: sessionService,
+		loginThrottle:  loginThrottle,
+		impersonation:  impersonation,
+		passwordHasher: passwordHasher,
+		userCSV:        userCSV,
 	}
 }
 
-// GetAllUsersHandler returns all users (admin only)
-func (uh *UserHandler) GetAllUsersHandler(c *gin.Context) {
-	userRows, err := uh.queries.ListUsers(c.Request.Context())
+// User listing limits
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// userSortFields are the fields the user listing can be sorted by
+var userSortFields = []string{"id", "email", "name", "created_at"}
+
+// likeEscaper escapes the ILIKE wildcards in a search term
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Pagination describes one page of a listing
+type Pagination struct {
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int64 `json:"total_pages"`
+}
+
+// ListUsersHandler returns one page of users (admin only). Query parameters:
+// q searches email and name, role filters by role name, state is active
+// (default), deleted or all, sort is one of userSortFields with a leading "-"
+// for descending order, page starts at 1 and limit is at most maxUserPageSize.
+func (uh *UserHandler) ListUsersHandler(c *gin.Context) {
+	params, page, limit, err := parseUserListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	total, err := uh.queries.CountUsers(c.Request.Context(), db.CountUsersParams{
+		Search: params.Search,
+		Role:   params.Role,
+		State:  params.State,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	userRows, err := uh.queries.SearchUsers(c.Request.Context(), params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
 		return
 	}
 
-	var users []models.User
+	users := make([]models.User, 0, len(userRows))
 	for _, row := range userRows {
-		// Fetch roles for each user
-		roles, _ := uh.queries.GetUserRoles(c.Request.Context(), row.ID)
-
-		apiUser := models.User{
-			ID:            uint(row.ID),
-			Email:         row.Email,
-			Name:          row.Name,
-			Tel:           row.Tel,
-			Age:           int(row.Age),
-			Gender:        row.Gender,
-			Address:       row.Address,
-			City:          row.City,
-			Country:       row.Country,
-			EmailVerified: row.EmailVerified,
-			CreatedAt:     row.CreatedAt,
-			UpdatedAt:     row.UpdatedAt,
-		}
-		for _, r := range roles {
-			apiUser.Roles = append(apiUser.Roles, models.Role{
-				ID:   uint(r.ID),
-				Name: r.Name,
-			})
-		}
-		if row.DeletedAt.Valid {
-			apiUser.DeletedAt = &row.DeletedAt.Time
+		apiUser := mappers.UserRowToModel(row)
+		if err := json.Unmarshal(row.Roles, &apiUser.Roles); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read user roles"})
+			return
 		}
 		users = append(users, apiUser)
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: users})
+	c.JSON(http.StatusOK, SuccessResponse{Data: gin.H{
+		"users": users,
+		"pagination": Pagination{
+			Page:       page,
+			Limit:      limit,
+			Total:      total,
+			TotalPages: (total + int64(limit) - 1) / int64(limit),
+		},
+	}})
 }
 
-// GetAllUsersWithDeletedHandler returns all users including soft-deleted ones (admin only)
-func (uh *UserHandler) GetAllUsersWithDeletedHandler(c *gin.Context) {
-	// We need a specific query for this or just use the one we have and check logic.
-	// Actually, GetUserByEmailWithDeleted exists but ListUsersWithDeleted doesn't.
-	// I'll use a direct query for now or add it to users.sql.
-	rows, err := uh.conn.QueryContext(c.Request.Context(), "SELECT id, email, password, name, COALESCE(tel, '') as tel, COALESCE(age, 0) as age, COALESCE(address, '') as address, COALESCE(city, '') as city, COALESCE(country, '') as country, COALESCE(gender, '') as gender, COALESCE(email_verified, false) as email_verified, COALESCE(created_at, 0) as created_at, COALESCE(updated_at, 0) as updated_at, deleted_at FROM users ORDER BY id")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
-		return
+// parseUserListQuery validates the query parameters of ListUsersHandler
+func parseUserListQuery(c *gin.Context) (db.SearchUsersParams, int, int, error) {
+	params := db.SearchUsersParams{
+		Search: likeEscaper.Replace(strings.TrimSpace(c.Query("q"))),
+		Role:   strings.TrimSpace(c.Query("role")),
+		State:  c.DefaultQuery("state", "active"),
+		Sort:   strings.TrimPrefix(c.DefaultQuery("sort", "id"), "-"),
 	}
-	defer rows.Close()
+	params.Descending = strings.HasPrefix(c.Query("sort"), "-")
 
-	var users []models.User
-	for rows.Next() {
-		var row db.GetUserByEmailWithDeletedRow
-		if err := rows.Scan(&row.ID, &row.Email, &row.Password, &row.Name, &row.Tel, &row.Age, &row.Address, &row.City, &row.Country, &row.Gender, &row.EmailVerified, &row.CreatedAt, &row.UpdatedAt, &row.DeletedAt); err != nil {
-			continue
-		}
+	switch params.State {
+	case "active", "deleted", "all":
+	default:
+		return params, 0, 0, errors.New("state must be active, deleted or all")
+	}
 
-		roles, _ := uh.queries.GetUserRoles(c.Request.Context(), row.ID)
-		apiUser := models.User{
-			ID:            uint(row.ID),
-			Email:         row.Email,
-			Name:          row.Name,
-			Tel:           row.Tel,
-			Age:           int(row.Age),
-			Gender:        row.Gender,
-			Address:       row.Address,
-			City:          row.City,
-			Country:       row.Country,
-			EmailVerified: row.EmailVerified,
-			CreatedAt:     row.CreatedAt,
-			UpdatedAt:     row.UpdatedAt,
-		}
-		for _, r := range roles {
-			apiUser.Roles = append(apiUser.Roles, models.Role{
-				ID:   uint(r.ID),
-				Name: r.Name,
-			})
-		}
-		if row.DeletedAt.Valid {
-			apiUser.DeletedAt = &row.DeletedAt.Time
-		}
-		users = append(users, apiUser)
+	if !slices.Contains(userSortFields, params.Sort) {
+		return params, 0, 0, fmt.Errorf("sort must be one of %s, optionally prefixed with -", strings.Join(userSortFields, ", "))
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return params, 0, 0, errors.New("page must be a positive number")
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultUserPageSize)))
+	if err != nil || limit < 1 || limit > maxUserPageSize {
+		return params, 0, 0, fmt.Errorf("limit must be between 1 and %d", maxUserPageSize)
+	}
+	if page > math.MaxInt32/limit {
+		return params, 0, 0, errors.New("page is out of range")
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{Data: users})
+	params.Limit = int32(limit)
+	params.Offset = int32((page - 1) * limit)
+	return params, page, limit, nil
 }
 
 // RestoreUserHandler restores a soft-deleted user (admin only)
@@ -647,9 +1522,9 @@ func (uh *UserHandler) UpdateUserHandler(c *gin.Context) {
 
 	currentUserObj := currentUser.(*models.User)
 
-	// Check if user is trying to update someone else (must be admin)
+	// Check if user is trying to update someone else (needs users:write)
 	if uint64(userID) != uint64(currentUserObj.ID) {
-		if !currentUserObj.HasRole("admin") {
+		if !currentUserObj.HasPermission(auth.PermUsersWrite) {
 			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden"})
 			return
 		}
@@ -725,6 +1600,8 @@ func (uh *UserHandler) UpdateUserHandler(c *gin.Context) {
 		return
 	}
 
+	setAuditChanges(c, newUserAudit(mappers.UserRowToModel(userRow)), newUserAudit(mappers.UserRowToModel(updatedRow)))
+
 	// Reload with roles
 	roles, _ := uh.queries.GetUserRoles(c.Request.Context(), int64(userID))
 	apiUser := models.User{
@@ -760,15 +1637,202 @@ func (uh *UserHandler) DeleteUserHandler(c *gin.Context) {
 		return
 	}
 
-	err = uh.queries.SoftDeleteUser(c.Request.Context(), int64(userID))
+	userRow, err := uh.queries.GetUserByID(c.Request.Context(), int64(userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	tx, err := uh.conn.BeginTx(c.Request.Context(), nil)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := uh.queries.WithTx(tx)
+
+	if err := qtx.SoftDeleteUser(c.Request.Context(), int64(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete user"})
+		return
+	}
+
+	// A deleted user must not keep any live session
+	if err := uh.sessionService.RevokeAllSessionsTx(c.Request.Context(), qtx, int64(userID)); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete user"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete user"})
+		return
+	}
+	setAuditChanges(c, newUserAudit(mappers.UserRowToModel(userRow)), nil)
+
 	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "User deleted successfully"}})
 }
 
+// ForceLogoutHandler ends every session of a user (admin only)
+func (uh *UserHandler) ForceLogoutHandler(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := strconv.ParseInt(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if _, err := uh.queries.GetUserByID(c.Request.Context(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	if err := uh.sessionService.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "User logged out of all sessions"}})
+}
+
+// UnlockUserHandler lifts a login lockout and clears failed login attempts (admin only)
+func (uh *UserHandler) UnlockUserHandler(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := strconv.ParseInt(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	userRow, err := uh.queries.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	if err := uh.loginThrottle.Unlock(c.Request.Context(), userRow.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "User unlocked"}})
+}
+
+// loginHistoryLimit caps how many sessions and attempts the login history returns
+const loginHistoryLimit = 100
+
+// LoginHistoryHandler returns a user's recent sessions, including ended
+// ones, and password login attempts (admin only)
+func (uh *UserHandler) LoginHistoryHandler(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := strconv.ParseInt(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	if _, err := uh.queries.GetUserByID(c.Request.Context(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	sessionRows, err := uh.queries.ListUserSessions(c.Request.Context(), db.ListUserSessionsParams{
+		UserID: userID,
+		Limit:  loginHistoryLimit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	attemptRows, err := uh.queries.ListUserLoginAttempts(c.Request.Context(), db.ListUserLoginAttemptsParams{
+		UserID: sql.NullInt64{Int64: userID, Valid: true},
+		Limit:  loginHistoryLimit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	impersonationRows, err := uh.queries.ListUserImpersonations(c.Request.Context(), db.ListUserImpersonationsParams{
+		UserID: userID,
+		Limit:  loginHistoryLimit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	sessions := make([]models.Session, 0, len(sessionRows))
+	for _, row := range sessionRows {
+		sessions = append(sessions, mappers.SessionRowToModel(row, ""))
+	}
+	attempts := make([]models.LoginAttempt, 0, len(attemptRows))
+	for _, row := range attemptRows {
+		attempts = append(attempts, mappers.LoginAttemptRowToModel(row))
+	}
+	impersonations := make([]models.Impersonation, 0, len(impersonationRows))
+	for _, row := range impersonationRows {
+		impersonations = append(impersonations, mappers.ImpersonationRowToModel(row))
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: gin.H{
+		"sessions":       sessions,
+		"login_attempts": attempts,
+		"impersonations": impersonations,
+	}})
+}
+
+// ImpersonateHandler issues a short-lived access token that acts as the user
+// on behalf of the current admin. There is no refresh token.
+func (uh *UserHandler) ImpersonateHandler(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := strconv.ParseInt(userIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return
+	}
+
+	admin, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	token, err := uh.impersonation.Start(c.Request.Context(), admin.(*models.User), userID, sessionClient(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImpersonationUserNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		case errors.Is(err, services.ErrImpersonateSelf):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Cannot impersonate yourself"})
+		case errors.Is(err, services.ErrImpersonatePrivileged):
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Users with privileged permissions cannot be impersonated"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start impersonation"})
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, SuccessResponse{Data: token})
+}
+
 // AssignRoleRequest represents the JSON payload for assigning roles
 type AssignRoleRequest struct {
 	RoleName string `json:"role_name" binding:"required"`
@@ -792,19 +1856,21 @@ func (uh *UserHandler) AssignRoleHandler(c *gin.Context) {
 	// Normalize role name
 	roleName := strings.ToLower(strings.TrimSpace(req.RoleName))
 
-	// Find or create the role
+	// Find the role; roles are not created implicitly
 	role, err := uh.queries.GetRoleByName(c.Request.Context(), roleName)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			role, err = uh.queries.CreateRole(c.Request.Context(), roleName)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error creating role"})
-				return
-			}
-		} else {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Role does not exist"})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	rolesBefore, err := uh.roleNames(c, int64(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
 	}
 
 	// Assign the role
@@ -817,6 +1883,12 @@ func (uh *UserHandler) AssignRoleHandler(c *gin.Context) {
 		return
 	}
 
+	rolesAfter, err := uh.roleNames(c, int64(userID))
+	if err != nil {
+		log.Printf("Failed to load roles of user %d for the audit log: %v", userID, err)
+	}
+	setAuditChanges(c, gin.H{"roles": rolesBefore}, gin.H{"roles": rolesAfter})
+
 	// Return user with roles (reusing GetUserByID logic)
 	uh.GetUserByIDHandler(c)
 }
@@ -853,6 +1925,12 @@ func (uh *UserHandler) RemoveRoleHandler(c *gin.Context) {
 		return
 	}
 
+	rolesBefore, err := uh.roleNames(c, int64(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
 	// Remove the role
 	err = uh.queries.RemoveRole(c.Request.Context(), db.RemoveRoleParams{
 		UserID: int64(userID),
@@ -863,10 +1941,56 @@ func (uh *UserHandler) RemoveRoleHandler(c *gin.Context) {
 		return
 	}
 
+	rolesAfter, err := uh.roleNames(c, int64(userID))
+	if err != nil {
+		log.Printf("Failed to load roles of user %d for the audit log: %v", userID, err)
+	}
+	setAuditChanges(c, gin.H{"roles": rolesBefore}, gin.H{"roles": rolesAfter})
+
 	// Return user with roles
 	uh.GetUserByIDHandler(c)
 }
 
+// roleNames returns the names of the user's roles, for the audit log
+func (uh *UserHandler) roleNames(c *gin.Context, userID int64) ([]string, error) {
+	roles, err := uh.queries.GetUserRoles(c.Request.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+	return names, nil
+}
+
+// userAudit is the part of a user recorded in the audit log
+type userAudit struct {
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Tel     string `json:"tel"`
+	Age     int    `json:"age"`
+	Address string `json:"address"`
+	City    string `json:"city"`
+	Country string `json:"country"`
+	Gender  string `json:"gender"`
+}
+
+// newUserAudit takes the audited fields of a user
+func newUserAudit(u models.User) userAudit {
+	return userAudit{
+		Email:   u.Email,
+		Name:    u.Name,
+		Tel:     u.Tel,
+		Age:     u.Age,
+		Address: u.Address,
+		City:    u.City,
+		Country: u.Country,
+		Gender:  u.Gender,
+	}
+}
+
 // ResetPasswordRequest represents the JSON payload for password reset
 type ResetPasswordRequest struct {
 	NewPassword string `json:"new_password" binding:"required,min=8"`
@@ -887,23 +2011,56 @@ func (uh *UserHandler) ResetUserPasswordHandler(c *gin.Context) {
 		return
 	}
 
+	userRow, err := uh.queries.GetUserByID(c.Request.Context(), int64(userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	if err := auth.ValidatePassword(req.NewPassword, userRow.Email); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Hash the new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	hashedPassword, err := uh.passwordHasher.Hash(req.NewPassword)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to process password"})
 		return
 	}
 
-	// In Pure SQL, we update the password directly
-	// Note: We don't have a specific UpdatePassword query, we can use UpdateUser or add a new one.
-	// For now, I'll just use a direct EXEC if I don't want to create a new sqlc query.
-	// But wait, it's better to add one to users.sql.
-	_, err = uh.conn.ExecContext(c.Request.Context(), "UPDATE users SET password = $2 WHERE id = $1", int64(userID), string(hashedPassword))
+	tx, err := uh.conn.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := uh.queries.WithTx(tx)
 
+	err = qtx.UpdateUserPassword(c.Request.Context(), db.UpdateUserPasswordParams{
+		ID:       userRow.ID,
+		Password: hashedPassword,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
 		return
 	}
 
+	// Sessions opened with the old password must not survive the reset
+	if err := uh.sessionService.RevokeAllSessionsTx(c.Request.Context(), qtx, userRow.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
 	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Password reset successfully"}})
 }
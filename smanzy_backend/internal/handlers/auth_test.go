@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseUserListQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func(query string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/users?"+query, nil)
+		return c
+	}
+
+	params, page, limit, err := parseUserListQuery(newContext(""))
+	if err != nil {
+		t.Fatalf("expected defaults to parse, got %v", err)
+	}
+	if params.State != "active" || params.Sort != "id" || params.Descending || page != 1 || limit != defaultUserPageSize || params.Offset != 0 {
+		t.Fatalf("unexpected defaults: %+v page=%d limit=%d", params, page, limit)
+	}
+
+	params, page, limit, err = parseUserListQuery(newContext("q=50%25_off&role=editor&state=all&sort=-created_at&page=3&limit=10"))
+	if err != nil {
+		t.Fatalf("expected query to parse, got %v", err)
+	}
+	if params.Search != `50\%\_off` {
+		t.Fatalf("expected wildcards to be escaped, got %q", params.Search)
+	}
+	if params.Role != "editor" || params.State != "all" || params.Sort != "created_at" || !params.Descending {
+		t.Fatalf("unexpected filters: %+v", params)
+	}
+	if page != 3 || limit != 10 || params.Limit != 10 || params.Offset != 20 {
+		t.Fatalf("unexpected pagination: %+v page=%d limit=%d", params, page, limit)
+	}
+
+	for _, query := range []string{"state=gone", "sort=password", "page=0", "limit=1000", "page=abc"} {
+		if _, _, _, err := parseUserListQuery(newContext(query)); err == nil {
+			t.Fatalf("expected %q to be rejected", query)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/services"
+)
+
+// InvitationHandler lets admins manage invitation codes
+type InvitationHandler struct {
+	invitationService *services.InvitationService
+}
+
+// NewInvitationHandler creates a new invitation handler
+func NewInvitationHandler(invitationService *services.InvitationService) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+	}
+}
+
+// CreateInvitationRequest is the request body for creating an invitation.
+// Every field is optional.
+type CreateInvitationRequest struct {
+	Role      string     `json:"role"`       // Granted on registration, in addition to the default role
+	MaxUses   *int32     `json:"max_uses"`   // Unlimited when omitted
+	ExpiresAt *time.Time `json:"expires_at"` // RFC 3339; never expires when omitted
+}
+
+// ListInvitationsHandler lists every invitation (without the codes themselves)
+func (ih *InvitationHandler) ListInvitationsHandler(c *gin.Context) {
+	invitations, err := ih.invitationService.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: invitations})
+}
+
+// CreateInvitationHandler creates an invitation. The response is the only time the code is shown.
+func (ih *InvitationHandler) CreateInvitationHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// An invitation that grants a role is a deferred role assignment
+	if req.Role != "" && !userObj.HasPermission(auth.PermRolesAssign) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions to grant a role"})
+		return
+	}
+
+	created, err := ih.invitationService.Create(c.Request.Context(), int64(userObj.ID), req.Role, req.MaxUses, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRoleNotFound):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Role does not exist"})
+		case errors.Is(err, services.ErrInvalidMaxUses):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Max uses must be at least 1"})
+		case errors.Is(err, services.ErrInvitationExpiryInPast):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Expiry must be in the future"})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create invitation"})
+		}
+		return
+	}
+
+	// Never the code itself
+	setAuditChanges(c, nil, newInvitationAudit(created.Invitation))
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, SuccessResponse{Data: created})
+}
+
+// DeleteInvitationHandler deletes an invitation so its code can no longer be used
+func (ih *InvitationHandler) DeleteInvitationHandler(c *gin.Context) {
+	invitationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid invitation ID"})
+		return
+	}
+
+	deleted, err := ih.invitationService.Delete(c.Request.Context(), invitationID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvitationNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete invitation"})
+		return
+	}
+	setAuditChanges(c, newInvitationAudit(*deleted), nil)
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Invitation deleted"}})
+}
+
+// invitationAudit holds the audited fields of an invitation
+type invitationAudit struct {
+	ID        int64      `json:"id"`
+	Prefix    string     `json:"prefix"`
+	Role      *string    `json:"role"`
+	MaxUses   *int32     `json:"max_uses"`
+	Uses      int32      `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// newInvitationAudit takes the audited fields of an invitation
+func newInvitationAudit(invitation services.Invitation) invitationAudit {
+	return invitationAudit{
+		ID:        invitation.ID,
+		Prefix:    invitation.Prefix,
+		Role:      invitation.Role,
+		MaxUses:   invitation.MaxUses,
+		Uses:      invitation.Uses,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ristep/smanzy_backend/internal/auth"
 	"github.com/ristep/smanzy_backend/internal/db"
 	"github.com/ristep/smanzy_backend/internal/models"
 )
@@ -374,8 +375,8 @@ func (mh *MediaHandler) UpdateMediaHandler(c *gin.Context) {
 		return
 	}
 
-	// Access Control: Owner or Admin
-	if uint64(mediaRow.UserID) != uint64(user.ID) && !user.HasRole("admin") {
+	// Access Control: Owner or media:write:any
+	if uint64(mediaRow.UserID) != uint64(user.ID) && !user.HasPermission(auth.PermMediaWriteAny) {
 		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden"})
 		return
 	}
@@ -467,8 +468,8 @@ func (mh *MediaHandler) DeleteMediaHandler(c *gin.Context) {
 		return
 	}
 
-	// Access Control: Owner or Admin
-	if uint64(mediaRow.UserID) != uint64(user.ID) && !user.HasRole("admin") {
+	// Access Control: Owner or media:delete:any
+	if uint64(mediaRow.UserID) != uint64(user.ID) && !user.HasPermission(auth.PermMediaDeleteAny) {
 		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Forbidden"})
 		return
 	}
@@ -483,6 +484,13 @@ func (mh *MediaHandler) DeleteMediaHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete media record: " + err.Error()})
 		return
 	}
+	setAuditChanges(c, gin.H{
+		"filename":    mediaRow.Filename,
+		"stored_name": mediaRow.StoredName,
+		"mime_type":   mediaRow.MimeType,
+		"size":        mediaRow.Size,
+		"user_id":     mediaRow.UserID,
+	}, nil)
 
 	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Media deleted successfully"}})
 }
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/oidc"
+	"github.com/ristep/smanzy_backend/internal/services"
+)
+
+const (
+	// oidcStateCookie carries the login state between redirect and callback
+	oidcStateCookie = "oidc_login"
+	// oidcStateMaxAge is how long (seconds) a login attempt may take at the provider
+	oidcStateMaxAge = 600
+)
+
+// OIDCHandler handles sign-in with an external OpenID Connect provider
+type OIDCHandler struct {
+	jwtService       *auth.JWTService
+	oidcService      *services.OIDCService
+	sessionService   *services.SessionService
+	twoFactorService *services.TwoFactorService
+	cookies          *auth.SessionCookies // nil unless cookie mode is on
+	appBaseURL       string
+}
+
+// NewOIDCHandler creates a new OIDC handler. appBaseURL is the frontend
+// origin the browser is sent back to after the callback.
+func NewOIDCHandler(jwtService *auth.JWTService, oidcService *services.OIDCService, sessionService *services.SessionService, twoFactorService *services.TwoFactorService, cookies *auth.SessionCookies, appBaseURL string) *OIDCHandler {
+	return &OIDCHandler{
+		jwtService:       jwtService,
+		oidcService:      oidcService,
+		sessionService:   sessionService,
+		twoFactorService: twoFactorService,
+		cookies:          cookies,
+		appBaseURL:       strings.TrimRight(appBaseURL, "/"),
+	}
+}
+
+// LoginHandler starts the authorization code + PKCE flow by redirecting the
+// browser to the provider
+func (oh *OIDCHandler) LoginHandler(c *gin.Context) {
+	state, err := oidc.NewLoginState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start login"})
+		return
+	}
+
+	authURL, err := oh.oidcService.Provider().AuthCodeURL(c.Request.Context(), state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC login unavailable: %v", err)
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Identity provider unavailable"})
+		return
+	}
+
+	oh.setStateCookie(c, state.Encode(), oidcStateMaxAge)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// CallbackHandler completes the flow: it checks the state, redeems the code,
+// signs the user in and redirects to APP_BASE_URL/oidc/callback with the
+// result in the URL fragment (never sent to servers)
+func (oh *OIDCHandler) CallbackHandler(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcStateCookie)
+	oh.setStateCookie(c, "", -1) // One attempt per state
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		oh.redirectWithResult(c, url.Values{"error": {providerErr}})
+		return
+	}
+
+	state, err := oidc.DecodeLoginState(cookie, c.Query("state"))
+	if err != nil {
+		oh.redirectWithResult(c, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	claims, err := oh.oidcService.Provider().Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		oh.redirectWithResult(c, url.Values{"error": {"exchange_failed"}})
+		return
+	}
+
+	if claims.Nonce != state.Nonce {
+		oh.redirectWithResult(c, url.Values{"error": {"invalid_nonce"}})
+		return
+	}
+
+	user, err := oh.oidcService.ResolveUser(c.Request.Context(), claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCEmailNotVerified):
+			oh.redirectWithResult(c, url.Values{"error": {"email_not_verified"}})
+		case errors.Is(err, services.ErrOIDCUserUnavailable):
+			oh.redirectWithResult(c, url.Values{"error": {"account_unavailable"}})
+		case errors.Is(err, services.ErrOIDCRegistrationClosed):
+			oh.redirectWithResult(c, url.Values{"error": {"registration_closed"}})
+		default:
+			log.Printf("OIDC sign-in failed: %v", err)
+			oh.redirectWithResult(c, url.Values{"error": {"server_error"}})
+		}
+		return
+	}
+
+	// The second factor still applies to accounts that have one
+	twoFactorEnabled, err := oh.twoFactorService.IsEnabled(c.Request.Context(), int64(user.ID))
+	if err != nil {
+		oh.redirectWithResult(c, url.Values{"error": {"server_error"}})
+		return
+	}
+	if twoFactorEnabled {
+		challenge, err := oh.jwtService.GeneratePurposeToken(user, auth.TokenTypeTwoFactorChallenge, services.TwoFactorChallengeTTL)
+		if err != nil {
+			oh.redirectWithResult(c, url.Values{"error": {"server_error"}})
+			return
+		}
+		oh.redirectWithResult(c, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {challenge},
+		})
+		return
+	}
+
+	tokenPair, err := oh.sessionService.IssueTokenPair(c.Request.Context(), user, false, sessionClient(c))
+	if err != nil {
+		oh.redirectWithResult(c, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	// In cookie mode the tokens stay in HttpOnly cookies and the frontend
+	// only learns the CSRF token
+	if oh.cookies != nil {
+		csrfToken, err := auth.NewCSRFToken()
+		if err != nil {
+			oh.redirectWithResult(c, url.Values{"error": {"server_error"}})
+			return
+		}
+		oh.cookies.Set(c.Writer, tokenPair, csrfToken)
+		oh.redirectWithResult(c, url.Values{"csrf_token": {csrfToken}})
+		return
+	}
+
+	oh.redirectWithResult(c, url.Values{
+		"access_token":  {tokenPair.AccessToken},
+		"refresh_token": {tokenPair.RefreshToken},
+	})
+}
+
+// setStateCookie sets (or with maxAge < 0 clears) the login state cookie
+func (oh *OIDCHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode, // Sent on the top-level redirect back from the provider
+	})
+}
+
+// redirectWithResult sends the browser back to the frontend
+func (oh *OIDCHandler) redirectWithResult(c *gin.Context, result url.Values) {
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, oh.appBaseURL+"/oidc/callback#"+result.Encode())
+}
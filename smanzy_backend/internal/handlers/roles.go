@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/services"
+)
+
+// RoleHandler handles role management requests
+type RoleHandler struct {
+	roleService *services.RoleService
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(roleService *services.RoleService) *RoleHandler {
+	return &RoleHandler{
+		roleService: roleService,
+	}
+}
+
+// CreateRoleRequest is the request body for creating a role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest is the request body for updating a role. Omitted
+// fields are left unchanged; an empty permissions list revokes them all.
+type UpdateRoleRequest struct {
+	Name        *string  `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// ListRolesHandler lists every role with its permissions and member count
+func (rh *RoleHandler) ListRolesHandler(c *gin.Context) {
+	roles, err := rh.roleService.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: roles})
+}
+
+// GetRoleHandler returns a single role
+func (rh *RoleHandler) GetRoleHandler(c *gin.Context) {
+	roleID, ok := parseRoleID(c)
+	if !ok {
+		return
+	}
+
+	role, err := rh.roleService.Get(c.Request.Context(), roleID)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: role})
+}
+
+// CreateRoleHandler creates a role
+func (rh *RoleHandler) CreateRoleHandler(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	role, err := rh.roleService.Create(c.Request.Context(), req.Name, req.Permissions)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+	setAuditChanges(c, nil, gin.H{"id": role.ID, "name": role.Name, "permissions": role.Permissions})
+
+	c.JSON(http.StatusCreated, SuccessResponse{Data: role})
+}
+
+// UpdateRoleHandler renames a role and/or replaces its permissions
+func (rh *RoleHandler) UpdateRoleHandler(c *gin.Context) {
+	roleID, ok := parseRoleID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before, err := rh.roleService.Get(c.Request.Context(), roleID)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	role, err := rh.roleService.Update(c.Request.Context(), roleID, req.Name, req.Permissions)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+	setAuditChanges(c, newRoleAudit(before), newRoleAudit(role))
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: role})
+}
+
+// DeleteRoleHandler deletes a role. Roles with members are only deleted
+// with ?cascade=true, which removes the role from its members.
+func (rh *RoleHandler) DeleteRoleHandler(c *gin.Context) {
+	roleID, ok := parseRoleID(c)
+	if !ok {
+		return
+	}
+
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+
+	role, err := rh.roleService.Get(c.Request.Context(), roleID)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	if err := rh.roleService.Delete(c.Request.Context(), roleID, cascade); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+	setAuditChanges(c, gin.H{"name": role.Name, "permissions": role.Permissions, "member_count": role.MemberCount}, nil)
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: map[string]string{"message": "Role deleted"}})
+}
+
+// ListRoleUsersHandler lists the users that have a role
+func (rh *RoleHandler) ListRoleUsersHandler(c *gin.Context) {
+	roleID, ok := parseRoleID(c)
+	if !ok {
+		return
+	}
+
+	users, err := rh.roleService.ListUsers(c.Request.Context(), roleID)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Data: users})
+}
+
+// roleAudit holds the audited fields of a role
+type roleAudit struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// newRoleAudit takes the audited fields of a role
+func newRoleAudit(role *models.RoleSummary) roleAudit {
+	return roleAudit{
+		Name:        role.Name,
+		Permissions: role.Permissions,
+	}
+}
+
+// parseRoleID reads the :id path parameter, responding 400 when it is invalid
+func parseRoleID(c *gin.Context) (int64, bool) {
+	roleID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid role ID"})
+		return 0, false
+	}
+	return roleID, true
+}
+
+// respondRoleError maps role service errors to responses
+func respondRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Role not found"})
+	case errors.Is(err, services.ErrRoleExists):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "A role with this name already exists"})
+	case errors.Is(err, services.ErrRoleHasMembers):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Role still has members; delete with ?cascade=true to remove it from them"})
+	case errors.Is(err, services.ErrRoleBuiltIn), errors.Is(err, services.ErrBuiltInPermissionsFixed):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrInvalidRoleName), errors.Is(err, services.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/services"
 )
 
 type SettingsHandler struct {
@@ -62,6 +63,25 @@ func (sh *SettingsHandler) UpdateSettingHandler(c *gin.Context) {
 		return
 	}
 
+	if err := services.ValidateSetting(key, req.Value); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Don't let an admin lock themselves out of the admin area
+	if key == services.SettingRequireAdmin2FA && req.Value == "true" && !sessionUsedMFA(c) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Sign in with two-factor authentication before requiring it for admins"})
+		return
+	}
+
+	before := gin.H{}
+	if oldValue, err := sh.queries.GetSetting(c.Request.Context(), key); err == nil {
+		before["value"] = oldValue
+	} else if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
 	setting, err := sh.queries.UpsertSetting(c.Request.Context(), db.UpsertSettingParams{
 		Key:   key,
 		Value: req.Value,
@@ -70,6 +90,7 @@ func (sh *SettingsHandler) UpdateSettingHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update setting"})
 		return
 	}
+	setAuditChanges(c, before, gin.H{"value": setting.Value})
 
 	c.JSON(http.StatusOK, SuccessResponse{Data: setting})
 }
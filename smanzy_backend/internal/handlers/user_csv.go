@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/services"
+)
+
+// maxImportFileSize caps the size of an uploaded import file
+const maxImportFileSize = 5 << 20
+
+// Notification choices for imported users
+const (
+	importNotifyNone   = "none"
+	importNotifyInvite = "invite"
+)
+
+// ImportUsersHandler creates users from a CSV file with the columns email,
+// name, tel, city, country and roles. The file is sent as the "file" field
+// of a multipart form or as the raw request body. Every row is validated
+// first; if any is invalid nothing is imported and all problems are
+// returned. With dry_run=true the validated rows are returned without
+// importing them. With notify=invite each new user is emailed a link to
+// choose their password.
+func (uh *UserHandler) ImportUsersHandler(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+	userObj := user.(*models.User)
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "dry_run must be true or false"})
+		return
+	}
+	notify := c.DefaultQuery("notify", importNotifyNone)
+	if notify != importNotifyNone && notify != importNotifyInvite {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "notify must be none or invite"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No file uploaded"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read file"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	rows, err := uh.userCSV.ParseImport(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("File is larger than %d MB", maxImportFileSize>>20)})
+		case errors.Is(err, services.ErrInvalidImportFile):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read file"})
+		}
+		return
+	}
+
+	// Roles in the file are role assignments
+	if !userObj.HasPermission(auth.PermRolesAssign) {
+		for _, row := range rows {
+			if len(row.Roles) > 0 {
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: "Insufficient permissions to assign roles"})
+				return
+			}
+		}
+	}
+
+	problems, err := uh.userCSV.Validate(c.Request.Context(), rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Database error"})
+		return
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, SuccessResponse{Data: gin.H{
+			"valid":  len(problems) == 0,
+			"rows":   rows,
+			"errors": problems,
+		}})
+		return
+	}
+
+	if len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "The file has invalid rows; nothing was imported",
+			"errors": problems,
+		})
+		return
+	}
+
+	imported, err := uh.userCSV.Import(c.Request.Context(), rows)
+	if err != nil {
+		log.Printf("User import by %d failed: %v", userObj.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to import users"})
+		return
+	}
+
+	var sent, failed int
+	if notify == importNotifyInvite {
+		sent, failed = uh.userCSV.SendInvitations(c.Request.Context(), imported)
+	}
+
+	setAuditChanges(c, nil, gin.H{"users": imported, "notify": notify})
+
+	c.JSON(http.StatusCreated, SuccessResponse{Data: gin.H{
+		"created":            len(imported),
+		"users":              imported,
+		"invitations_sent":   sent,
+		"invitations_failed": failed,
+	}})
+}
+
+// ExportUsersHandler downloads the users matching the listing filters (q,
+// role, state and sort, see ListUsersHandler) as a CSV file
+func (uh *UserHandler) ExportUsersHandler(c *gin.Context) {
+	params, _, _, err := parseUserListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	setAuditChanges(c, nil, gin.H{"search": c.Query("q"), "role": params.Role, "state": params.State})
+
+	filename := fmt.Sprintf("smanzy-users-%s.csv", time.Now().UTC().Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	// Headers are already sent; a failure can only cut the file short
+	if err := uh.userCSV.WriteCSV(c.Request.Context(), params, c.Writer); err != nil {
+		log.Printf("User export failed: %v", err)
+		c.Abort()
+	}
+}
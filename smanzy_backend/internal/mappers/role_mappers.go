@@ -0,0 +1,35 @@
+package mappers
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+// RoleSummaryRowToModel converts a database role summary row to a RoleSummary model
+func RoleSummaryRowToModel(row interface{}) models.RoleSummary {
+	switch r := row.(type) {
+	case db.ListRoleSummariesRow:
+		return roleSummary(r.ID, r.Name, r.Permissions, r.MemberCount, r.CreatedAt, r.UpdatedAt)
+	case db.GetRoleSummaryRow:
+		return roleSummary(r.ID, r.Name, r.Permissions, r.MemberCount, r.CreatedAt, r.UpdatedAt)
+	default:
+		// Return empty role if type not recognized to avoid panics
+		return models.RoleSummary{}
+	}
+}
+
+func roleSummary(id int64, name, permissions string, memberCount, createdAt, updatedAt int64) models.RoleSummary {
+	return models.RoleSummary{
+		ID:          uint(id),
+		Name:        name,
+		Permissions: strings.Fields(permissions), // Aggregated space separated in SQL
+		MemberCount: memberCount,
+		BuiltIn:     slices.Contains(auth.BuiltInRoles, name),
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
+	}
+}
@@ -0,0 +1,48 @@
+package mappers
+
+import (
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+// SessionRowToModel converts a database session row to a Session model.
+// currentFamilyID marks the session the request was made with.
+func SessionRowToModel(row db.UserSession, currentFamilyID string) models.Session {
+	session := models.Session{
+		ID:         row.FamilyID,
+		IP:         row.Ip,
+		UserAgent:  row.UserAgent,
+		Current:    currentFamilyID != "" && row.FamilyID == currentFamilyID,
+		CreatedAt:  row.CreatedAt,
+		LastUsedAt: row.LastUsedAt,
+		ExpiresAt:  row.ExpiresAt,
+	}
+	if row.RevokedAt.Valid {
+		session.RevokedAt = &row.RevokedAt.Time
+	}
+	return session
+}
+
+// LoginAttemptRowToModel converts a database login attempt row to a LoginAttempt model
+func LoginAttemptRowToModel(row db.LoginAttempt) models.LoginAttempt {
+	return models.LoginAttempt{
+		IP:        row.Ip,
+		Succeeded: row.Succeeded,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+// ImpersonationRowToModel converts a database impersonation row to an Impersonation model
+func ImpersonationRowToModel(row db.Impersonation) models.Impersonation {
+	impersonation := models.Impersonation{
+		IP:        row.Ip,
+		UserAgent: row.UserAgent,
+		CreatedAt: row.CreatedAt,
+		ExpiresAt: row.ExpiresAt,
+	}
+	if row.AdminID.Valid {
+		adminID := uint(row.AdminID.Int64)
+		impersonation.AdminID = &adminID
+	}
+	return impersonation
+}
@@ -25,6 +25,7 @@ func UserRowToModel(row interface{}) models.User {
 			EmailVerified: r.EmailVerified,
 			CreatedAt:     r.CreatedAt,
 			UpdatedAt:     r.UpdatedAt,
+			TokenVersion:  r.TokenVersion,
 		}
 	case db.GetUserByEmailRow:
 		return models.User{
@@ -40,8 +41,29 @@ func UserRowToModel(row interface{}) models.User {
 			EmailVerified: r.EmailVerified,
 			CreatedAt:     r.CreatedAt,
 			UpdatedAt:     r.UpdatedAt,
+			TokenVersion:  r.TokenVersion,
 		}
-	case db.ListUsersRow:
+	case db.SearchUsersRow:
+		user := models.User{
+			ID:            uint(r.ID),
+			Email:         r.Email,
+			Name:          r.Name,
+			Tel:           r.Tel,
+			Age:           int(r.Age),
+			Gender:        r.Gender,
+			Address:       r.Address,
+			City:          r.City,
+			Country:       r.Country,
+			EmailVerified: r.EmailVerified,
+			CreatedAt:     r.CreatedAt,
+			UpdatedAt:     r.UpdatedAt,
+		}
+		// SearchUsersRow includes soft delete information which needs to be mapped optionally
+		if r.DeletedAt.Valid {
+			user.DeletedAt = &r.DeletedAt.Time
+		}
+		return user
+	case db.ListRoleUsersRow:
 		user := models.User{
 			ID:            uint(r.ID),
 			Email:         r.Email,
@@ -56,7 +78,6 @@ func UserRowToModel(row interface{}) models.User {
 			CreatedAt:     r.CreatedAt,
 			UpdatedAt:     r.UpdatedAt,
 		}
-		// ListUsersRow includes soft delete information which needs to be mapped optionally
 		if r.DeletedAt.Valid {
 			user.DeletedAt = &r.DeletedAt.Time
 		}
@@ -96,12 +117,3 @@ func UserRowToModel(row interface{}) models.User {
 		return models.User{}
 	}
 }
-
-// ListUsersRowsToModels converts multiple user rows to User models
-func ListUsersRowsToModels(rows []db.ListUsersRow) []models.User {
-	users := make([]models.User, len(rows))
-	for i, row := range rows {
-		users[i] = UserRowToModel(row)
-	}
-	return users
-}
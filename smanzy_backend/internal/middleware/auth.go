@@ -2,8 +2,13 @@ package middleware
 
 // zz
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"log"
 	"net/http"
+	"reflect"
+	"runtime"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -11,31 +16,54 @@ import (
 	"github.com/ristep/smanzy_backend/internal/auth"
 	"github.com/ristep/smanzy_backend/internal/db"
 	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/services"
 )
 
-// AuthMiddleware validates JWT tokens and attaches user claims to the request context
+// AuthMiddleware validates JWT tokens and attaches user claims to the request context.
+// Personal API keys are accepted as Bearer credentials too, but only on routes
+// that declare the scope they need with RequireScope. Without an
+// Authorization header the access token cookie of cookie mode is used, and
+// state-changing requests must then carry the CSRF token.
 func AuthMiddleware(jwtService *auth.JWTService, queries *db.Queries) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract the token from the Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization header"})
-			c.Abort()
-			return
-		}
+		var tokenString string
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			// Check for Bearer scheme
+			const bearerScheme = "Bearer "
+			if !strings.HasPrefix(authHeader, bearerScheme) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+				c.Abort()
+				return
+			}
 
-		// Check for Bearer scheme
-		const bearerScheme = "Bearer "
-		if !strings.HasPrefix(authHeader, bearerScheme) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
-			return
-		}
+			tokenString = authHeader[len(bearerScheme):]
 
-		tokenString := authHeader[len(bearerScheme):]
+			if auth.IsAPIKey(tokenString) {
+				authenticateAPIKey(c, queries, tokenString)
+				return
+			}
+		} else {
+			// Or from the access token cookie
+			cookie, err := c.Cookie(auth.AccessTokenCookie)
+			if err != nil || cookie == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization header"})
+				c.Abort()
+				return
+			}
 
-		// Validate the token
-		claims, err := jwtService.ValidateToken(tokenString)
+			// Browsers attach cookies to requests other sites make, too
+			if !auth.CSRFSafeMethod(c.Request.Method) && !auth.ValidCSRF(c.Request) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+				c.Abort()
+				return
+			}
+
+			tokenString = cookie
+		}
+
+		// Validate the token (only access tokens are accepted as Bearer tokens)
+		claims, err := jwtService.ValidateToken(tokenString, auth.TokenTypeAccess)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
@@ -54,43 +82,176 @@ func AuthMiddleware(jwtService *auth.JWTService, queries *db.Queries) gin.Handle
 			return
 		}
 
-		// Fetch roles
-		roles, _ := queries.GetUserRoles(c.Request.Context(), userRow.ID)
-
-		// Map to models.User (DTO)
-		apiUser := models.User{
-			ID:            uint(userRow.ID),
-			Email:         userRow.Email,
-			Name:          userRow.Name,
-			Tel:           userRow.Tel,
-			Age:           int(userRow.Age),
-			Gender:        userRow.Gender,
-			Address:       userRow.Address,
-			City:          userRow.City,
-			Country:       userRow.Country,
-			EmailVerified: userRow.EmailVerified,
-			CreatedAt:     userRow.CreatedAt,
-			UpdatedAt:     userRow.UpdatedAt,
-		}
-		for _, r := range roles {
-			apiUser.Roles = append(apiUser.Roles, models.Role{
-				ID:   uint(r.ID),
-				Name: r.Name,
+		// Reject tokens issued before the user's last logout-everywhere
+		if claims.Version != userRow.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Reject tokens that were denylisted by a logout or whose session was revoked
+		if claims.ID != "" {
+			revoked, err := queries.IsAccessTokenRevoked(c.Request.Context(), db.IsAccessTokenRevokedParams{
+				Jti:      claims.ID,
+				FamilyID: claims.FamilyID,
 			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+				c.Abort()
+				return
+			}
 		}
 
-		// Attach user and claims to context
-		c.Set("user", &apiUser)
+		// Impersonation tokens stop working as soon as the admin loses the right to impersonate
+		if claims.ImpersonatorID != 0 {
+			impersonator, ok := loadImpersonator(c, queries, claims.ImpersonatorID)
+			if !ok {
+				return
+			}
+			c.Set("impersonator", impersonator)
+		}
+
+		apiUser := userWithRoles(c.Request.Context(), queries, userRow)
+
+		// Attach user and claims to context. On impersonation tokens "user" is
+		// the impersonated user and "impersonator" the admin acting as them.
+		c.Set("user", apiUser)
 		c.Set("claims", claims)
 
 		c.Next()
 	}
 }
 
-// RoleMiddleware checks if the authenticated user has at least one of the required roles
-func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
+// loadImpersonator loads the admin behind an impersonation token, aborting
+// the request when they no longer exist or may no longer impersonate
+func loadImpersonator(c *gin.Context, queries *db.Queries, adminID uint) (*models.User, bool) {
+	adminRow, err := queries.GetUserByID(c.Request.Context(), int64(adminID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		c.Abort()
+		return nil, false
+	}
+
+	admin := userWithRoles(c.Request.Context(), queries, adminRow)
+	if !admin.HasPermission(auth.PermUsersImpersonate) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		c.Abort()
+		return nil, false
+	}
+
+	return admin, true
+}
+
+// authenticateAPIKey authenticates a request made with a personal API key
+// and attaches the key owner and the key to the request context
+func authenticateAPIKey(c *gin.Context, queries *db.Queries, key string) {
+	// Deny by default: keys only work where a scope is required
+	if !routeAcceptsAPIKeys(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys are not accepted for this endpoint"})
+		c.Abort()
+		return
+	}
+
+	apiKey, userID, err := services.AuthenticateAPIKey(c.Request.Context(), queries, key)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		c.Abort()
+		return
+	}
+
+	userRow, err := queries.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		c.Abort()
+		return
+	}
+
+	c.Set("user", userWithRoles(c.Request.Context(), queries, userRow))
+	c.Set("api_key", apiKey)
+
+	c.Next()
+}
+
+// userWithRoles maps a user row, its roles and permissions to models.User (DTO)
+func userWithRoles(ctx context.Context, queries *db.Queries, userRow db.GetUserByIDRow) *models.User {
+	roles, _ := queries.GetUserRoles(ctx, userRow.ID)
+	permissions, _ := queries.GetUserPermissions(ctx, userRow.ID)
+
+	apiUser := models.User{
+		ID:            uint(userRow.ID),
+		Email:         userRow.Email,
+		Name:          userRow.Name,
+		Tel:           userRow.Tel,
+		Age:           int(userRow.Age),
+		Gender:        userRow.Gender,
+		Address:       userRow.Address,
+		City:          userRow.City,
+		Country:       userRow.Country,
+		EmailVerified: userRow.EmailVerified,
+		CreatedAt:     userRow.CreatedAt,
+		UpdatedAt:     userRow.UpdatedAt,
+		TokenVersion:  userRow.TokenVersion,
+		Permissions:   permissions,
+	}
+	for _, r := range roles {
+		apiUser.Roles = append(apiUser.Roles, models.Role{
+			ID:   uint(r.ID),
+			Name: r.Name,
+		})
+	}
+
+	return &apiUser
+}
+
+// RequireScope restricts API key requests to keys granted the scope.
+// Requests authenticated with a JWT are not affected. Must run after
+// AuthMiddleware; routes without it reject API keys entirely.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := c.Get("api_key"); ok && !auth.HasScope(key.(*services.APIKey).Scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireScopeName is the handler name gin reports for RequireScope handlers
+var requireScopeName = runtime.FuncForPC(reflect.ValueOf(RequireScope("")).Pointer()).Name()
+
+// routeAcceptsAPIKeys reports whether the matched route has a RequireScope handler
+func routeAcceptsAPIKeys(c *gin.Context) bool {
+	for _, name := range c.HandlerNames() {
+		if name == requireScopeName {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission checks that one of the authenticated user's roles grants
+// the permission. Must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get user from context (should be set by AuthMiddleware)
 		user, exists := c.Get("user")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -105,22 +266,22 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 			return
 		}
 
-		// Check if user has any of the allowed roles
-		hasRole := false
-		for _, userRole := range userObj.Roles {
-			for _, allowedRole := range allowedRoles {
-				if userRole.Name == allowedRole {
-					hasRole = true
-					break
-				}
-			}
-			if hasRole {
-				break
-			}
+		if !userObj.HasPermission(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
 		}
 
-		if !hasRole {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Next()
+	}
+}
+
+// DenyImpersonation blocks impersonated sessions from actions only the user
+// themselves may take, such as changing their password or 2FA settings
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("impersonator"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating a user"})
 			c.Abort()
 			return
 		}
@@ -129,16 +290,118 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	}
 }
 
-// CORSMiddleware handles CORS headers
-func CORSMiddleware() gin.HandlerFunc {
+// Audit records the request in the audit log. Handlers set "audit_changes"
+// to a services.AuditChanges describing what changed as soon as the change
+// is committed, and the request is then recorded whatever the final status,
+// since a later step failing does not undo the change. Requests without it
+// are recorded when they end with a 2xx response. The target ID is the
+// route's :id or :key parameter. The response has already been sent by then,
+// so a failure to record is only logged.
+func Audit(auditService *services.AuditService, action, targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		changes, committed := c.Get("audit_changes")
+		if status := c.Writer.Status(); !committed && (status < 200 || status > 299 || c.IsAborted()) {
+			return
+		}
+
+		entry := services.AuditEntry{
+			Action:     action,
+			TargetType: targetType,
+			TargetID:   c.Param("id"),
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+		}
+		if entry.TargetID == "" {
+			entry.TargetID = c.Param("key")
+		}
+		if user, ok := c.Get("user"); ok {
+			entry.ActorID = int64(user.(*models.User).ID)
+		}
+		if impersonator, ok := c.Get("impersonator"); ok {
+			entry.ImpersonatorID = int64(impersonator.(*models.User).ID)
+		}
+		if committed {
+			entry.Changes = changes.(services.AuditChanges)
+		}
+
+		// Record even if the client has gone away in the meantime
+		if err := auditService.Record(context.WithoutCancel(c.Request.Context()), entry); err != nil {
+			log.Printf("Failed to record %s of %s %s in the audit log: %v", action, targetType, entry.TargetID, err)
+		}
+	}
+}
+
+// VerifiedEmailMiddleware blocks users with an unverified email address when
+// the unverified-user-access setting forbids them to upload
+func VerifiedEmailMiddleware(queries *db.Queries) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		user, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
+		userObj, ok := user.(*models.User)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
+			c.Abort()
+			return
+		}
+
+		if !userObj.EmailVerified {
+			policy, err := services.GetSettingOrDefault(c.Request.Context(), queries, services.SettingUnverifiedUserAccess, services.UnverifiedAccessFull)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			if policy != services.UnverifiedAccessFull {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// AdminTwoFactorMiddleware rejects sessions that were not established with a
+// second factor when the require-admin-2fa setting applies to the user.
+// Must run after AuthMiddleware.
+func AdminTwoFactorMiddleware(queries *db.Queries) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		userObj, ok := user.(*models.User)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
+			c.Abort()
+			return
+		}
+
+		if claims, ok := c.Get("claims"); ok && claims.(*auth.CustomClaims).MFA {
+			c.Next()
+			return
+		}
+
+		required, err := services.RequiresTwoFactor(c.Request.Context(), queries, userObj)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if required {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required"})
+			c.Abort()
 			return
 		}
 
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/services"
+)
+
+func TestAuthMiddleware_RejectsRefreshToken(t *testing.T) {
+	jwtService := auth.NewJWTService("test-secret")
+	pair, err := jwtService.GenerateTokenPair(&models.User{ID: 1, Email: "user@example.com"}, "family-1", false)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// The token is rejected before any database lookup, so no queries are needed
+	router.GET("/api/profile", AuthMiddleware(jwtService, nil), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.RefreshToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for refresh token on protected route, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_RejectsMissingHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/profile", AuthMiddleware(auth.NewJWTService("test-secret"), nil), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without authorization header, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_CookieRequiresCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// Both outcomes are decided before any database lookup
+	router.POST("/api/profile", AuthMiddleware(auth.NewJWTService("test-secret"), nil), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(csrfHeader string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/profile", nil)
+		req.AddCookie(&http.Cookie{Name: auth.AccessTokenCookie, Value: "not-a-jwt"})
+		req.AddCookie(&http.Cookie{Name: auth.CSRFCookie, Value: "csrf-1"})
+		if csrfHeader != "" {
+			req.Header.Set(auth.CSRFHeader, csrfHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(""); code != http.StatusForbidden {
+		t.Fatalf("expected 403 without CSRF header, got %d", code)
+	}
+	if code := send("csrf-2"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for mismatched CSRF header, got %d", code)
+	}
+	// A matching token gets as far as validating the access token
+	if code := send("csrf-1"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for invalid access token cookie, got %d", code)
+	}
+}
+
+func TestAdminTwoFactorMiddleware_AllowsMFASession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// An MFA session is accepted without consulting the settings, so no queries are needed
+	router.GET("/api/users", func(c *gin.Context) {
+		c.Set("user", &models.User{ID: 1, Roles: []models.Role{{Name: "admin"}}})
+		c.Set("claims", &auth.CustomClaims{UserID: 1, MFA: true})
+	}, AdminTwoFactorMiddleware(nil), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for MFA session, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_RejectsAPIKeyOnUnscopedRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// The key is rejected before any database lookup, so no queries are needed
+	router.GET("/api/profile", AuthMiddleware(auth.NewJWTService("test-secret"), nil), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+auth.APIKeyPrefix+"not-a-real-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for API key on unscoped route, got %d", w.Code)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		key    *services.APIKey
+		status int
+	}{
+		{"jwt session", nil, http.StatusOK},
+		{"key with scope", &services.APIKey{Scopes: []string{auth.ScopeMediaWrite}}, http.StatusOK},
+		{"key without scope", &services.APIKey{Scopes: []string{auth.ScopeVideosSync}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		router := gin.New()
+		router.POST("/api/media", func(c *gin.Context) {
+			if tt.key != nil {
+				c.Set("api_key", tt.key)
+			}
+		}, RequireScope(auth.ScopeMediaWrite), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/media", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		user   *models.User
+		status int
+	}{
+		{"no user", nil, http.StatusUnauthorized},
+		{"with permission", &models.User{Permissions: []string{auth.PermUsersRead}}, http.StatusOK},
+		{"admin role without permission", &models.User{Roles: []models.Role{{Name: auth.RoleAdmin}}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		router := gin.New()
+		router.GET("/api/users", func(c *gin.Context) {
+			if tt.user != nil {
+				c.Set("user", tt.user)
+			}
+		}, RequirePermission(auth.PermUsersRead), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		impersonator *models.User
+		status       int
+	}{
+		{"own session", nil, http.StatusOK},
+		{"impersonated session", &models.User{ID: 1}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		router := gin.New()
+		router.PUT("/api/profile/password", func(c *gin.Context) {
+			if tt.impersonator != nil {
+				c.Set("impersonator", tt.impersonator)
+			}
+		}, DenyImpersonation(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/api/profile/password", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers and methods every CORS policy allows
+const (
+	corsAllowedHeaders = "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With"
+	corsAllowedMethods = "POST, OPTIONS, GET, PUT, DELETE, PATCH"
+	corsExposedHeaders = "Content-Disposition, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy"
+)
+
+// CORSPolicy decides which origins may call a set of routes from a browser.
+// Allowed origins are exact origins ("https://app.example.com"), wildcard
+// subdomain patterns ("https://*.example.com", which does not match
+// example.com itself) or "*" for any origin.
+type CORSPolicy struct {
+	anyOrigin        bool
+	origins          map[string]bool
+	subdomains       []corsOrigin // Wildcard patterns, host without the "*"
+	allowCredentials bool
+	maxAge           int // Seconds browsers may cache a preflight result
+}
+
+// corsOrigin is an origin split into its parts
+type corsOrigin struct {
+	scheme, host, port string
+}
+
+// NewCORSPolicy builds a policy from an origin allowlist. Credentials
+// (cookies and Authorization headers) are only allowed for listed origins,
+// never together with "*".
+func NewCORSPolicy(allowedOrigins []string, allowCredentials bool, maxAge time.Duration) (*CORSPolicy, error) {
+	policy := &CORSPolicy{
+		origins:          make(map[string]bool),
+		allowCredentials: allowCredentials,
+		maxAge:           int(maxAge.Seconds()),
+	}
+
+	for _, pattern := range allowedOrigins {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case pattern == "":
+			continue
+		case pattern == "*":
+			if allowCredentials {
+				return nil, errors.New(`origin "*" cannot be allowed together with credentials`)
+			}
+			policy.anyOrigin = true
+			continue
+		}
+
+		wildcard := strings.Contains(pattern, "://*.")
+		origin, ok := parseOrigin(strings.Replace(pattern, "://*.", "://", 1))
+		if !ok {
+			return nil, fmt.Errorf("invalid origin %q, expected scheme://host[:port] or scheme://*.domain[:port]", pattern)
+		}
+
+		if wildcard {
+			origin.host = "." + origin.host
+			policy.subdomains = append(policy.subdomains, origin)
+		} else {
+			policy.origins[origin.String()] = true
+		}
+	}
+
+	return policy, nil
+}
+
+// AllowsOrigin reports whether browsers at origin may call the routes
+func (p *CORSPolicy) AllowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	o, ok := parseOrigin(origin)
+	if !ok {
+		return false
+	}
+	if p.origins[o.String()] {
+		return true
+	}
+	for _, sub := range p.subdomains {
+		if o.scheme == sub.scheme && o.port == sub.port && strings.HasSuffix(o.host, sub.host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOrigin splits an origin, lowercased, and checks that it is only a
+// scheme, host and optional port
+func parseOrigin(origin string) (corsOrigin, bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" || strings.Contains(u.Host, "*") || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return corsOrigin{}, false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return corsOrigin{}, false
+	}
+	return corsOrigin{
+		scheme: strings.ToLower(u.Scheme),
+		host:   strings.ToLower(u.Hostname()),
+		port:   u.Port(),
+	}, true
+}
+
+// String formats the origin the way browsers send it
+func (o corsOrigin) String() string {
+	if o.port == "" {
+		return o.scheme + "://" + o.host
+	}
+	return o.scheme + "://" + o.host + ":" + o.port
+}
+
+// CORSMiddleware applies a CORS policy to each request. defaultPolicy covers
+// every route; groupPolicies overrides it for the routes under a path prefix,
+// the longest matching prefix winning. A nil policy sends no CORS headers, so
+// only same-origin pages can use those routes. It must be installed on the
+// router rather than on a group: preflight requests match no route, and only
+// router middleware sees them.
+func CORSMiddleware(defaultPolicy *CORSPolicy, groupPolicies map[string]*CORSPolicy) gin.HandlerFunc {
+	prefixes := make([]string, 0, len(groupPolicies))
+	for prefix := range groupPolicies {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return func(c *gin.Context) {
+		policy := defaultPolicy
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				policy = groupPolicies[prefix]
+				break
+			}
+		}
+
+		// The response depends on the Origin header, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		if origin == "" || policy == nil || !policy.AllowsOrigin(origin) {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if policy.anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.allowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			header.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			header.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			if policy.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(policy.maxAge))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		c.Next()
+	}
+}
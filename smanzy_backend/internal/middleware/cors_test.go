@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSPolicy_AllowsOrigin(t *testing.T) {
+	policy, err := NewCORSPolicy([]string{"https://app.example.com", "https://*.example.org", "http://localhost:5173"}, true, time.Minute)
+	if err != nil {
+		t.Fatalf("expected policy to be valid, got %v", err)
+	}
+
+	for origin, want := range map[string]bool{
+		"https://app.example.com":      true,
+		"HTTPS://APP.EXAMPLE.COM":      true,
+		"http://app.example.com":       false, // Scheme must match
+		"https://evil.example.com":     false,
+		"https://a.example.org":        true,
+		"https://a.b.example.org":      true,
+		"https://example.org":          false, // Wildcards only match subdomains
+		"https://evilexample.org":      false,
+		"https://a.example.org:8443":   false, // Port must match
+		"http://localhost:5173":        true,
+		"http://localhost:3000":        false,
+		"null":                         false,
+		"https://app.example.com/path": false,
+	} {
+		if got := policy.AllowsOrigin(origin); got != want {
+			t.Errorf("AllowsOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	if _, err := NewCORSPolicy([]string{"*"}, true, 0); err == nil {
+		t.Error("expected \"*\" with credentials to be rejected")
+	}
+	if _, err := NewCORSPolicy([]string{"app.example.com"}, false, 0); err == nil {
+		t.Error("expected origin without scheme to be rejected")
+	}
+	if _, err := NewCORSPolicy([]string{"https://app.*.example.com"}, false, 0); err == nil {
+		t.Error("expected wildcard inside the host to be rejected")
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	appPolicy, err := NewCORSPolicy([]string{"https://app.example.com"}, true, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("expected policy to be valid, got %v", err)
+	}
+	publicPolicy, err := NewCORSPolicy([]string{"*"}, false, 0)
+	if err != nil {
+		t.Fatalf("expected policy to be valid, got %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORSMiddleware(appPolicy, map[string]*CORSPolicy{"/.well-known/": publicPolicy}))
+	router.GET("/api/profile", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// An allowed origin is echoed, never "*", when credentials are allowed
+	w := send(http.MethodGet, "/api/profile", "https://app.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("expected allowed origin to be echoed, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Fatalf("expected credentials to be allowed, got %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Fatalf("expected Vary: Origin, got %q", got)
+	}
+
+	// Preflights for a route group are answered and may be cached
+	w = send(http.MethodOptions, "/api/profile", "https://app.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("expected cached preflight, got %d with Max-Age %q", w.Code, w.Header().Get("Access-Control-Max-Age"))
+	}
+
+	// Other origins get no CORS headers, so browsers block the response
+	w = send(http.MethodOptions, "/api/profile", "https://evil.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("expected no CORS headers for other origin, got %q", got)
+	}
+
+	// The public group has its own policy
+	w = send(http.MethodGet, "/.well-known/jwks.json", "https://evil.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("expected any origin on public route, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("expected no credentials on public route, got %q", got)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ulule/limiter/v3"
+
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+// RateLimit limits how often each principal may call the routes it guards:
+// the authenticated user when there is one, otherwise the client IP. Counters
+// are kept per policy name, so routes under different policies don't share
+// them. Responses carry the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset (seconds until the window ends) and RateLimit-Policy
+// headers; requests over the limit get 429 with Retry-After. When the store
+// fails, requests are let through rather than taking the API down with it.
+// Place it after AuthMiddleware to count per user.
+func RateLimit(policy string, l *limiter.Limiter) gin.HandlerFunc {
+	policyHeader := fmt.Sprintf("%d;w=%d", l.Rate.Limit, int64(l.Rate.Period.Seconds()))
+
+	return func(c *gin.Context) {
+		key := policy + ":" + rateLimitPrincipal(c)
+
+		state, err := l.Get(c.Request.Context(), key)
+		if err != nil {
+			log.Printf("Rate limit check for %s failed: %v", key, err)
+			c.Next()
+			return
+		}
+
+		reset := max(state.Reset-time.Now().Unix(), 0)
+		c.Header("RateLimit-Limit", strconv.FormatInt(state.Limit, 10))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(state.Remaining, 10))
+		c.Header("RateLimit-Reset", strconv.FormatInt(reset, 10))
+		c.Header("RateLimit-Policy", policyHeader)
+
+		if state.Reached {
+			c.Header("Retry-After", strconv.FormatInt(reset, 10))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded. Try again later."})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitPrincipal identifies who a request counts against
+func rateLimitPrincipal(c *gin.Context) string {
+	if user, ok := c.Get("user"); ok {
+		return "user:" + strconv.FormatUint(uint64(user.(*models.User).ID), 10)
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+func TestRateLimit(t *testing.T) {
+	l := limiter.New(memory.NewStore(), limiter.Rate{Period: time.Minute, Limit: 2})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/media", func(c *gin.Context) {
+		if c.GetHeader("X-Test-User") != "" {
+			c.Set("user", &models.User{ID: 7})
+		}
+	}, RateLimit("api", l), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(asUser bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/media", nil)
+		if asUser {
+			req.Header.Set("X-Test-User", "1")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", w.Code)
+	}
+	if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" || w.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Fatalf("unexpected rate limit headers: %v", w.Header())
+	}
+
+	send(false)
+	w = send(false)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 over the limit, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected Retry-After and no remaining requests, got %v", w.Header())
+	}
+
+	// An authenticated user has their own counter, separate from their IP's
+	if w := send(true); w.Code != http.StatusOK {
+		t.Fatalf("expected user request to pass, got %d", w.Code)
+	}
+}
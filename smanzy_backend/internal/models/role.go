@@ -0,0 +1,12 @@
+package models
+
+// RoleSummary describes a role for role management
+type RoleSummary struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	MemberCount int64    `json:"member_count"`
+	BuiltIn     bool     `json:"built_in"` // Seeded at startup; cannot be renamed or deleted
+	CreatedAt   int64    `json:"created_at"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Session represents a login session (one refresh token family)
+type Session struct {
+	ID         string     `json:"id"` // Refresh token family ID
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"` // The session the request was made with
+	CreatedAt  int64      `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// LoginAttempt represents a password login attempt
+type LoginAttempt struct {
+	IP        string    `json:"ip"`
+	Succeeded bool      `json:"succeeded"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Impersonation represents an admin acting as the user
+type Impersonation struct {
+	AdminID   *uint     `json:"admin_id"` // nil once the admin's account is purged
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt int64     `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
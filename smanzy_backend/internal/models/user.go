@@ -16,9 +16,11 @@ type User struct {
 	Gender        string     `json:"gender"`
 	EmailVerified bool       `json:"email_verified"`
 	Roles         []Role     `json:"roles"`
+	Permissions   []string   `json:"permissions,omitempty"` // Union of the roles' permissions, loaded per request
 	CreatedAt     int64      `json:"created_at"`
 	UpdatedAt     int64      `json:"updated_at"`
 	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	TokenVersion  int64      `json:"-"` // Embedded in tokens; bumped to revoke them all
 }
 
 // Role represents a role in the system (e.g. "admin", "user")
@@ -40,3 +42,14 @@ func (u *User) HasRole(roleName string) bool {
 	}
 	return false
 }
+
+// HasPermission checks if any of the user's roles grants the permission.
+// Permissions are only loaded for the authenticated user of a request.
+func (u *User) HasPermission(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
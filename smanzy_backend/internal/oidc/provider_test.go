@@ -0,0 +1,152 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/oidc"
+	"github.com/ristep/smanzy_backend/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/api/auth/oidc/callback"
+
+// signIn runs the browser part of the flow against the mock provider and
+// returns the code and state it redirected back with
+func signIn(t *testing.T, p *oidc.Provider, ls *oidc.LoginState) (string, string) {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), ls.State, ls.Nonce, ls.CodeVerifier)
+	if err != nil {
+		t.Fatalf("failed to build auth url: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect from authorize, got %d", resp.StatusCode)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid callback url: %v", err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func newProvider(t *testing.T, clientSecret string) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+
+	mock, srv, err := oidctest.NewServer("smanzy", "client-secret")
+	if err != nil {
+		t.Fatalf("failed to start mock provider: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	return mock, oidc.NewProvider(oidc.Config{
+		IssuerURL:    mock.Issuer,
+		ClientID:     "smanzy",
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	})
+}
+
+func TestProvider_AuthorizationCodeFlow(t *testing.T) {
+	_, p := newProvider(t, "client-secret")
+
+	ls, err := oidc.NewLoginState()
+	if err != nil {
+		t.Fatalf("failed to create login state: %v", err)
+	}
+
+	code, state := signIn(t, p, ls)
+	if _, err := oidc.DecodeLoginState(ls.Encode(), state); err != nil {
+		t.Fatalf("expected state to round-trip, got %v", err)
+	}
+
+	claims, err := p.Exchange(context.Background(), code, ls.CodeVerifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if claims.Subject != "oidctest-user" || claims.Email != "oidc.user@example.com" || !bool(claims.EmailVerified) {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if claims.Nonce != ls.Nonce {
+		t.Fatalf("expected nonce %q, got %q", ls.Nonce, claims.Nonce)
+	}
+
+	// Codes are single use
+	if _, err := p.Exchange(context.Background(), code, ls.CodeVerifier); err == nil {
+		t.Fatal("expected second exchange of the same code to fail")
+	}
+}
+
+func TestProvider_RejectsWrongCodeVerifier(t *testing.T) {
+	_, p := newProvider(t, "client-secret")
+
+	ls, _ := oidc.NewLoginState()
+	code, _ := signIn(t, p, ls)
+
+	other, _ := oidc.NewLoginState()
+	if _, err := p.Exchange(context.Background(), code, other.CodeVerifier); err == nil {
+		t.Fatal("expected exchange with a different PKCE verifier to fail")
+	}
+}
+
+func TestProvider_RejectsWrongClientSecret(t *testing.T) {
+	_, p := newProvider(t, "wrong-secret")
+
+	ls, _ := oidc.NewLoginState()
+	code, _ := signIn(t, p, ls)
+
+	if _, err := p.Exchange(context.Background(), code, ls.CodeVerifier); err == nil {
+		t.Fatal("expected exchange with the wrong client secret to fail")
+	}
+}
+
+func TestProvider_VerifyIDToken(t *testing.T) {
+	mock, p := newProvider(t, "client-secret")
+	ctx := context.Background()
+
+	valid, err := mock.IDToken(mock.User, "smanzy", "n", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to sign id token: %v", err)
+	}
+	if _, err := p.VerifyIDToken(ctx, valid); err != nil {
+		t.Fatalf("expected id token to verify, got %v", err)
+	}
+
+	otherAudience, _ := mock.IDToken(mock.User, "other-client", "n", time.Minute)
+	if _, err := p.VerifyIDToken(ctx, otherAudience); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected token for another client to be rejected, got %v", err)
+	}
+
+	expired, _ := mock.IDToken(mock.User, "smanzy", "n", -time.Hour)
+	if _, err := p.VerifyIDToken(ctx, expired); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected expired token to be rejected, got %v", err)
+	}
+
+	if _, err := p.VerifyIDToken(ctx, "not-a-token"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected malformed token to be rejected, got %v", err)
+	}
+}
+
+func TestDecodeLoginState_RejectsMismatch(t *testing.T) {
+	ls, _ := oidc.NewLoginState()
+
+	if _, err := oidc.DecodeLoginState(ls.Encode(), "forged-state"); !errors.Is(err, oidc.ErrStateMismatch) {
+		t.Fatalf("expected ErrStateMismatch, got %v", err)
+	}
+	if _, err := oidc.DecodeLoginState("garbage", ls.State); !errors.Is(err, oidc.ErrStateMismatch) {
+		t.Fatalf("expected ErrStateMismatch for malformed cookie, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LoginState holds the per-attempt secrets of an authorization code flow.
+// It is kept by the browser in a short-lived HttpOnly cookie between the
+// redirect to the provider and the callback.
+type LoginState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// ErrStateMismatch is returned when the callback does not belong to the login attempt
+var ErrStateMismatch = errors.New("oidc state mismatch")
+
+// NewLoginState generates fresh random values for a login attempt
+func NewLoginState() (*LoginState, error) {
+	var values [3]string
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate login state: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return &LoginState{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// Encode serializes the state for the cookie
+func (ls *LoginState) Encode() string {
+	return ls.State + "." + ls.Nonce + "." + ls.CodeVerifier
+}
+
+// DecodeLoginState parses a cookie value and checks it belongs to the
+// state returned by the provider
+func DecodeLoginState(cookie, state string) (*LoginState, error) {
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, ErrStateMismatch
+	}
+
+	if subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		return nil, ErrStateMismatch
+	}
+
+	return &LoginState{State: parts[0], Nonce: parts[1], CodeVerifier: parts[2]}, nil
+}
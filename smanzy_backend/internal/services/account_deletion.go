@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// DefaultAccountDeletionGracePeriod is how long a user has to change their
+// mind after asking for their account to be deleted
+const DefaultAccountDeletionGracePeriod = 14 * 24 * time.Hour
+
+// AccountDeletionService handles self-requested account deletion. A request
+// only schedules the deletion: the user is logged out everywhere, and signing
+// in again before the grace period ends cancels it. Once it ends the account
+// is soft deleted.
+type AccountDeletionService struct {
+	conn           *sql.DB
+	queries        *db.Queries
+	sessionService *SessionService
+	gracePeriod    time.Duration
+}
+
+// NewAccountDeletionService creates a new account deletion service
+func NewAccountDeletionService(conn *sql.DB, queries *db.Queries, sessionService *SessionService, gracePeriod time.Duration) *AccountDeletionService {
+	return &AccountDeletionService{
+		conn:           conn,
+		queries:        queries,
+		sessionService: sessionService,
+		gracePeriod:    gracePeriod,
+	}
+}
+
+// Schedule marks the user's account for deletion and ends all of their
+// sessions. It returns when the deletion takes effect.
+func (ad *AccountDeletionService) Schedule(ctx context.Context, userID int64) (time.Time, error) {
+	deleteAt := time.Now().Add(ad.gracePeriod)
+
+	tx, err := ad.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := ad.queries.WithTx(tx)
+
+	err = qtx.ScheduleUserDeletion(ctx, db.ScheduleUserDeletionParams{
+		ID:                  userID,
+		DeletionScheduledAt: sql.NullTime{Time: deleteAt, Valid: true},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := ad.sessionService.RevokeAllSessionsTx(ctx, qtx, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+	return deleteAt, nil
+}
+
+// DeleteDue soft deletes every account whose grace period has ended and
+// returns their IDs
+func (ad *AccountDeletionService) DeleteDue(ctx context.Context) ([]int64, error) {
+	return ad.queries.SoftDeleteScheduledUsers(ctx)
+}
+
+// Run calls DeleteDue every interval until ctx is done
+func (ad *AccountDeletionService) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, func(ctx context.Context) {
+		ids, err := ad.DeleteDue(ctx)
+		if err != nil {
+			log.Printf("Scheduled account deletion failed: %v", err)
+		} else if len(ids) > 0 {
+			log.Printf("Deleted %d account(s) after their grace period: %v", len(ids), ids)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// MaxAPIKeysPerUser caps how many keys a single user can hold
+const MaxAPIKeysPerUser = 20
+
+var (
+	// ErrAPIKeyNotFound is returned when a key does not exist or belongs to someone else
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrAPIKeyLimitReached is returned when the user already has MaxAPIKeysPerUser keys
+	ErrAPIKeyLimitReached = errors.New("api key limit reached")
+	// ErrAPIKeyExpiryInPast is returned when a key is requested with an expiry that has passed
+	ErrAPIKeyExpiryInPast = errors.New("api key expiry must be in the future")
+)
+
+// APIKey describes a stored key; the key itself is never available again
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  int64      `json:"created_at"`
+}
+
+// CreatedAPIKey is returned once, when the key is created
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyService manages personal API keys
+type APIKeyService struct {
+	conn    *sql.DB
+	queries *db.Queries
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(conn *sql.DB, queries *db.Queries) *APIKeyService {
+	return &APIKeyService{
+		conn:    conn,
+		queries: queries,
+	}
+}
+
+// Create issues a new key for the user. expiresAt is optional.
+func (ks *APIKeyService) Create(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time) (*CreatedAPIKey, error) {
+	scopes, err := auth.ParseScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrAPIKeyExpiryInPast
+	}
+
+	count, err := ks.queries.CountUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxAPIKeysPerUser {
+		return nil, ErrAPIKeyLimitReached
+	}
+
+	key, keyHash, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var expires sql.NullTime
+	if expiresAt != nil {
+		expires = sql.NullTime{Time: *expiresAt, Valid: true}
+	}
+
+	row, err := ks.queries.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expires,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedAPIKey{APIKey: apiKeyFromRow(row), Key: key}, nil
+}
+
+// List returns the user's keys, newest first
+func (ks *APIKeyService) List(ctx context.Context, userID int64) ([]APIKey, error) {
+	rows, err := ks.queries.ListUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, apiKeyFromRow(row))
+	}
+	return keys, nil
+}
+
+// Revoke deletes one of the user's keys
+func (ks *APIKeyService) Revoke(ctx context.Context, userID, keyID int64) error {
+	deleted, err := ks.queries.DeleteUserAPIKey(ctx, db.DeleteUserAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey looks up an unexpired key and records its use
+func AuthenticateAPIKey(ctx context.Context, queries *db.Queries, key string) (*APIKey, int64, error) {
+	row, err := queries.GetAPIKeyByHash(ctx, auth.HashOpaqueToken(key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, ErrAPIKeyNotFound
+		}
+		return nil, 0, err
+	}
+
+	// Bookkeeping only; a failure here must not block the request
+	_ = queries.TouchAPIKey(ctx, row.ID)
+
+	apiKey := apiKeyFromRow(row)
+	return &apiKey, row.UserID, nil
+}
+
+// apiKeyFromRow converts a database row to its API representation
+func apiKeyFromRow(row db.ApiKey) APIKey {
+	key := APIKey{
+		ID:        row.ID,
+		Name:      row.Name,
+		Prefix:    row.Prefix,
+		Scopes:    strings.Fields(row.Scopes),
+		CreatedAt: row.CreatedAt,
+	}
+	if row.ExpiresAt.Valid {
+		key.ExpiresAt = &row.ExpiresAt.Time
+	}
+	if row.LastUsedAt.Valid {
+		key.LastUsedAt = &row.LastUsedAt.Time
+	}
+	return key
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// Audited actions, named target.verb
+const (
+	AuditUserUpdate        = "user.update"
+	AuditUserDelete        = "user.delete"
+	AuditUserRestore       = "user.restore"
+	AuditUserLogout        = "user.logout"
+	AuditUserUnlock        = "user.unlock"
+	AuditUserImpersonate   = "user.impersonate"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditUserRoleAssign    = "user.role_assign"
+	AuditUserRoleRemove    = "user.role_remove"
+	AuditUserImport        = "user.import"
+	AuditUserExport        = "user.export"
+	AuditSettingUpdate     = "setting.update"
+	AuditMediaDelete       = "media.delete"
+	AuditAlbumDelete       = "album.delete"
+	AuditRoleCreate        = "role.create"
+	AuditRoleUpdate        = "role.update"
+	AuditRoleDelete        = "role.delete"
+	AuditInvitationCreate  = "invitation.create"
+	AuditInvitationDelete  = "invitation.delete"
+)
+
+// Audited target types
+const (
+	AuditTargetUser       = "user"
+	AuditTargetSetting    = "setting"
+	AuditTargetMedia      = "media"
+	AuditTargetAlbum      = "album"
+	AuditTargetRole       = "role"
+	AuditTargetInvitation = "invitation"
+)
+
+// AuditChanges holds the fields of a target that an action changed, with
+// their values before and after it
+type AuditChanges struct {
+	Before map[string]json.RawMessage
+	After  map[string]json.RawMessage
+}
+
+// NewAuditChanges compares two snapshots of a target and keeps the fields
+// that differ. A snapshot is anything that marshals to a JSON object; nil
+// stands for a target that did not exist before or no longer exists after
+// the action.
+func NewAuditChanges(before, after any) (AuditChanges, error) {
+	beforeFields, err := auditSnapshot(before)
+	if err != nil {
+		return AuditChanges{}, err
+	}
+	afterFields, err := auditSnapshot(after)
+	if err != nil {
+		return AuditChanges{}, err
+	}
+
+	changes := AuditChanges{
+		Before: make(map[string]json.RawMessage),
+		After:  make(map[string]json.RawMessage),
+	}
+	for key, value := range beforeFields {
+		if other, ok := afterFields[key]; !ok || !bytes.Equal(value, other) {
+			changes.Before[key] = value
+		}
+	}
+	for key, value := range afterFields {
+		if other, ok := beforeFields[key]; !ok || !bytes.Equal(value, other) {
+			changes.After[key] = value
+		}
+	}
+	return changes, nil
+}
+
+// auditSnapshot marshals a snapshot to its fields, leaving out null ones
+func auditSnapshot(snapshot any) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if snapshot == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("audit snapshot is not a JSON object: %w", err)
+	}
+	for key, value := range fields {
+		if string(value) == "null" {
+			delete(fields, key)
+		}
+	}
+	return fields, nil
+}
+
+// AuditEntry is an action to record in the audit log
+type AuditEntry struct {
+	ActorID        int64
+	ImpersonatorID int64 // Zero unless the actor was being impersonated
+	Action         string
+	TargetType     string
+	TargetID       string
+	Changes        AuditChanges
+	IP             string
+	UserAgent      string
+}
+
+// AuditLogEntry is a recorded action as returned by the API
+type AuditLogEntry struct {
+	ID             int64           `json:"id"`
+	ActorID        *int64          `json:"actor_id"`
+	ActorEmail     *string         `json:"actor_email"`
+	ImpersonatorID *int64          `json:"impersonator_id,omitempty"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type"`
+	TargetID       string          `json:"target_id"`
+	Before         json.RawMessage `json:"before"`
+	After          json.RawMessage `json:"after"`
+	IP             string          `json:"ip"`
+	UserAgent      string          `json:"user_agent"`
+	CreatedAt      int64           `json:"created_at"`
+}
+
+// AuditService records privileged actions and lists them for admins
+type AuditService struct {
+	queries *db.Queries
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(queries *db.Queries) *AuditService {
+	return &AuditService{
+		queries: queries,
+	}
+}
+
+// Record stores an entry in the audit log
+func (au *AuditService) Record(ctx context.Context, entry AuditEntry) error {
+	before, err := json.Marshal(auditFieldsOrEmpty(entry.Changes.Before))
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(auditFieldsOrEmpty(entry.Changes.After))
+	if err != nil {
+		return err
+	}
+
+	return au.queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+		ActorID:        sql.NullInt64{Int64: entry.ActorID, Valid: entry.ActorID != 0},
+		ImpersonatorID: sql.NullInt64{Int64: entry.ImpersonatorID, Valid: entry.ImpersonatorID != 0},
+		Action:         entry.Action,
+		TargetType:     entry.TargetType,
+		TargetID:       entry.TargetID,
+		Before:         before,
+		After:          after,
+		Ip:             entry.IP,
+		UserAgent:      entry.UserAgent,
+	})
+}
+
+// List returns one page of the audit log, newest first, and the number of
+// entries matching the filters. Limit and Offset of params are used as is.
+func (au *AuditService) List(ctx context.Context, params db.ListAuditLogParams) ([]AuditLogEntry, int64, error) {
+	total, err := au.queries.CountAuditLog(ctx, db.CountAuditLogParams{
+		ActorID:    params.ActorID,
+		Action:     params.Action,
+		TargetType: params.TargetType,
+		TargetID:   params.TargetID,
+		Since:      params.Since,
+		Until:      params.Until,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := au.queries.ListAuditLog(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]AuditLogEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := AuditLogEntry{
+			ID:         row.ID,
+			Action:     row.Action,
+			TargetType: row.TargetType,
+			TargetID:   row.TargetID,
+			Before:     row.Before,
+			After:      row.After,
+			IP:         row.Ip,
+			UserAgent:  row.UserAgent,
+			CreatedAt:  row.CreatedAt,
+		}
+		if row.ActorID.Valid {
+			entry.ActorID = &row.ActorID.Int64
+		}
+		if row.ActorEmail.Valid {
+			entry.ActorEmail = &row.ActorEmail.String
+		}
+		if row.ImpersonatorID.Valid {
+			entry.ImpersonatorID = &row.ImpersonatorID.Int64
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, nil
+}
+
+// auditFieldsOrEmpty makes a missing set of fields marshal to {} rather than null
+func auditFieldsOrEmpty(fields map[string]json.RawMessage) map[string]json.RawMessage {
+	if fields == nil {
+		return map[string]json.RawMessage{}
+	}
+	return fields
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestNewAuditChanges(t *testing.T) {
+	type snapshot struct {
+		Name  string   `json:"name"`
+		City  string   `json:"city"`
+		Roles []string `json:"roles"`
+	}
+
+	changes, err := NewAuditChanges(
+		snapshot{Name: "Ana", City: "Skopje", Roles: []string{"user"}},
+		snapshot{Name: "Ana", City: "Ohrid", Roles: []string{"user", "editor"}},
+	)
+	if err != nil {
+		t.Fatalf("expected snapshots to compare, got %v", err)
+	}
+	if len(changes.Before) != 2 || string(changes.Before["city"]) != `"Skopje"` || string(changes.Before["roles"]) != `["user"]` {
+		t.Fatalf("unexpected before: %s", changes.Before)
+	}
+	if len(changes.After) != 2 || string(changes.After["city"]) != `"Ohrid"` || string(changes.After["roles"]) != `["user","editor"]` {
+		t.Fatalf("unexpected after: %s", changes.After)
+	}
+
+	// A deletion keeps the whole snapshot, without null fields
+	changes, err = NewAuditChanges(snapshot{Name: "Ana"}, nil)
+	if err != nil {
+		t.Fatalf("expected snapshots to compare, got %v", err)
+	}
+	if len(changes.Before) != 2 || string(changes.Before["name"]) != `"Ana"` || len(changes.After) != 0 {
+		t.Fatalf("unexpected deletion changes: before=%s after=%s", changes.Before, changes.After)
+	}
+
+	if _, err := NewAuditChanges("not an object", nil); err == nil {
+		t.Fatal("expected a snapshot that is not a JSON object to be rejected")
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// detachedTimeout bounds work started by runDetached
+const detachedTimeout = time.Minute
+
+// runEvery calls fn right away and then every interval until ctx is done
+func runEvery(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDetached runs fn in the background so a request can be answered without
+// waiting for it. fn keeps the values of ctx but not its cancellation, and
+// gets detachedTimeout to finish; its error is logged as "Failed to <what>".
+func runDetached(ctx context.Context, what string, fn func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), detachedTimeout)
+	go func() {
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			log.Printf("Failed to %s: %v", what, err)
+		}
+	}()
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mappers"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+// exportedAlbum is an album in a data export, with the IDs of its media
+type exportedAlbum struct {
+	models.Album
+	MediaIDs []uint `json:"media_ids"`
+}
+
+// exportedMedia is a media item in a data export. File is its path in the
+// archive, empty when the original file is missing from the upload directory.
+type exportedMedia struct {
+	models.Media
+	File string `json:"file,omitempty"`
+}
+
+// DataExportService builds a downloadable copy of a user's data
+type DataExportService struct {
+	queries   *db.Queries
+	uploadDir string
+}
+
+// NewDataExportService creates a new data export service
+func NewDataExportService(queries *db.Queries, uploadDir string) *DataExportService {
+	return &DataExportService{
+		queries:   queries,
+		uploadDir: uploadDir,
+	}
+}
+
+// WriteZIP writes a ZIP archive of the user's profile, albums, media
+// metadata and original media files to w. The archive is streamed, so an
+// error can occur after part of it has been written.
+func (es *DataExportService) WriteZIP(ctx context.Context, user *models.User, w io.Writer) error {
+	albumRows, err := es.queries.ListUserAlbums(ctx, int64(user.ID))
+	if err != nil {
+		return fmt.Errorf("failed to list albums: %w", err)
+	}
+	albums := make([]exportedAlbum, 0, len(albumRows))
+	for _, row := range albumRows {
+		mediaRows, err := es.queries.GetAlbumMedia(ctx, row.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list media of album %d: %w", row.ID, err)
+		}
+		album := exportedAlbum{Album: mappers.AlbumRowToModel(row), MediaIDs: make([]uint, 0, len(mediaRows))}
+		for _, m := range mediaRows {
+			album.MediaIDs = append(album.MediaIDs, uint(m.ID))
+		}
+		albums = append(albums, album)
+	}
+
+	mediaRows, err := es.queries.ListUserMedia(ctx, int64(user.ID))
+	if err != nil {
+		return fmt.Errorf("failed to list media: %w", err)
+	}
+	media := make([]exportedMedia, 0, len(mediaRows))
+	for _, row := range mediaRows {
+		item := exportedMedia{Media: mappers.MediaRowToModel(row)}
+		if _, err := os.Stat(es.mediaPath(row.StoredName)); err == nil {
+			item.File = fmt.Sprintf("media/%d_%s", row.ID, filepath.Base(row.Filename))
+		}
+		media = append(media, item)
+	}
+
+	zw := zip.NewWriter(w)
+
+	if err := writeJSONEntry(zw, "profile.json", user); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(zw, "albums.json", albums); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(zw, "media.json", media); err != nil {
+		return err
+	}
+
+	for _, item := range media {
+		if item.File == "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := es.copyFile(zw, item.File, es.mediaPath(item.StoredName)); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// mediaPath returns where a stored media file lives on disk
+func (es *DataExportService) mediaPath(storedName string) string {
+	return filepath.Join(es.uploadDir, filepath.Base(storedName))
+}
+
+// copyFile stores a file in the archive as is; media is usually compressed already
+func (es *DataExportService) copyFile(zw *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		// Removed since the listing; the metadata still names it
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, f)
+	return err
+}
+
+// writeJSONEntry adds v to the archive as an indented JSON file
+func writeJSONEntry(zw *zip.Writer, name string, v any) error {
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
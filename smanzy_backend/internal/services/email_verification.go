@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ulule/limiter/v3"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mailer"
+	"github.com/ristep/smanzy_backend/internal/mappers"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+// EmailVerificationTTL is how long a verification link stays valid
+const EmailVerificationTTL = 24 * time.Hour
+
+var (
+	// ErrInvalidVerificationToken is returned for unknown, expired or stale verification links
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	// ErrVerificationRateLimited is returned when too many verification emails were requested
+	ErrVerificationRateLimited = errors.New("too many verification emails requested")
+)
+
+// EmailVerificationService sends and confirms signed email verification links
+type EmailVerificationService struct {
+	queries       *db.Queries
+	jwtService    *auth.JWTService
+	mailer        mailer.Mailer
+	appBaseURL    string
+	resendLimiter *limiter.Limiter
+}
+
+// NewEmailVerificationService creates a new email verification service.
+// appBaseURL is the frontend origin the verification link points to. Resend
+// requests are counted in limitStore, which all replicas should share.
+func NewEmailVerificationService(queries *db.Queries, jwtService *auth.JWTService, m mailer.Mailer, appBaseURL string, limitStore limiter.Store) *EmailVerificationService {
+	return &EmailVerificationService{
+		queries:    queries,
+		jwtService: jwtService,
+		mailer:     m,
+		appBaseURL: strings.TrimRight(appBaseURL, "/"),
+		// At most 3 resends per address per hour
+		resendLimiter: limiter.New(limitStore, limiter.Rate{Period: time.Hour, Limit: 3}),
+	}
+}
+
+// SendVerification emails a verification link to the user
+func (vs *EmailVerificationService) SendVerification(ctx context.Context, user *models.User) error {
+	token, err := vs.jwtService.GeneratePurposeToken(user, auth.TokenTypeEmailVerification, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", vs.appBaseURL, url.QueryEscape(token))
+
+	return vs.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %d hours.\n",
+			user.Name, link, int(EmailVerificationTTL.Hours())),
+	})
+}
+
+// Verify confirms the email address encoded in a verification token
+func (vs *EmailVerificationService) Verify(ctx context.Context, token string) error {
+	claims, err := vs.jwtService.ValidateToken(token, auth.TokenTypeEmailVerification)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	userRow, err := vs.queries.GetUserByID(ctx, int64(claims.UserID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+
+	// The link is only good for the address it was sent to
+	if !strings.EqualFold(userRow.Email, claims.Email) {
+		return ErrInvalidVerificationToken
+	}
+
+	if userRow.EmailVerified {
+		return nil
+	}
+
+	return vs.queries.SetUserEmailVerified(ctx, userRow.ID)
+}
+
+// Resend emails a new verification link. The account is looked up and the
+// email sent in the background, and unknown or already verified addresses
+// are silently ignored, so neither the result nor the time taken reveals
+// them. Failures are only logged.
+func (vs *EmailVerificationService) Resend(ctx context.Context, email string) error {
+	limit, err := vs.resendLimiter.Get(ctx, "resend:"+strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+	if limit.Reached {
+		return ErrVerificationRateLimited
+	}
+
+	runDetached(ctx, "resend verification email", func(ctx context.Context) error {
+		return vs.resend(ctx, email)
+	})
+	return nil
+}
+
+// resend emails a verification link if the address belongs to an
+// unverified account
+func (vs *EmailVerificationService) resend(ctx context.Context, email string) error {
+	userRow, err := vs.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if userRow.EmailVerified {
+		return nil
+	}
+
+	user := mappers.UserRowToModel(userRow)
+	return vs.SendVerification(ctx, &user)
+}
+
+// UnverifiedAccess returns the configured policy for users with an unverified email
+func (vs *EmailVerificationService) UnverifiedAccess(ctx context.Context) (string, error) {
+	return GetSettingOrDefault(ctx, vs.queries, SettingUnverifiedUserAccess, UnverifiedAccessFull)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// fakeQueryHandler answers a query by its sqlc name. For statements that
+// return no rows, the number of rows returned is reported as rows affected.
+type fakeQueryHandler func(name string, args []driver.Value) (*fakeRows, error)
+
+// newFakeDB opens a database whose queries are answered by handle, one at a
+// time, so services can be tested without Postgres. Transactions are not
+// isolated and rollbacks undo nothing.
+func newFakeDB(t *testing.T, handle fakeQueryHandler) *sql.DB {
+	conn := sql.OpenDB(&fakeDriver{handle: handle})
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+var queryName = regexp.MustCompile(`^-- name: (\w+)`)
+
+type fakeDriver struct {
+	mu     sync.Mutex
+	handle fakeQueryHandler
+}
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return d.Open("") }
+func (d *fakeDriver) Driver() driver.Driver                        { return d }
+func (d *fakeDriver) Open(string) (driver.Conn, error)             { return fakeConn{d}, nil }
+
+func (d *fakeDriver) run(name string, args []driver.Value) (*fakeRows, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.handle(name, args)
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	match := queryName.FindStringSubmatch(query)
+	if match == nil {
+		return nil, fmt.Errorf("unnamed query %q", query)
+	}
+	return fakeStmt{driver: c.driver, name: match[1]}, nil
+}
+
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c fakeConn) Commit() error             { return nil }
+func (c fakeConn) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	driver *fakeDriver
+	name   string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.driver.run(s.name, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows.rows)), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.driver.run(s.name, args)
+}
+
+// fakeRows returns rows of any width; column names are not checked
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) add(values ...driver.Value) { r.rows = append(r.rows, values) }
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mappers"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+var (
+	// ErrImpersonationUserNotFound is returned when the user to impersonate does not exist
+	ErrImpersonationUserNotFound = errors.New("user not found")
+	// ErrImpersonateSelf is returned when an admin tries to impersonate themselves
+	ErrImpersonateSelf = errors.New("cannot impersonate yourself")
+	// ErrImpersonatePrivileged is returned for users holding a privileged permission,
+	// so impersonation can never be used to gain permissions
+	ErrImpersonatePrivileged = errors.New("users with privileged permissions cannot be impersonated")
+)
+
+// ImpersonationToken is returned when an impersonation starts
+type ImpersonationToken struct {
+	AccessToken    string       `json:"access_token"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	User           *models.User `json:"user"`
+	ImpersonatorID uint         `json:"impersonator_id"`
+}
+
+// ImpersonationService lets support staff act as a user to see what they see.
+// Every impersonation is recorded with the admin, client and token ID.
+type ImpersonationService struct {
+	queries    *db.Queries
+	jwtService *auth.JWTService
+}
+
+// NewImpersonationService creates a new impersonation service
+func NewImpersonationService(queries *db.Queries, jwtService *auth.JWTService) *ImpersonationService {
+	return &ImpersonationService{
+		queries:    queries,
+		jwtService: jwtService,
+	}
+}
+
+// Start issues a short-lived access token that authenticates as the user on
+// behalf of admin
+func (im *ImpersonationService) Start(ctx context.Context, admin *models.User, userID int64, client SessionClient) (*ImpersonationToken, error) {
+	if userID == int64(admin.ID) {
+		return nil, ErrImpersonateSelf
+	}
+
+	userRow, err := im.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrImpersonationUserNotFound
+		}
+		return nil, err
+	}
+
+	permissions, err := im.queries.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range permissions {
+		if slices.Contains(auth.PrivilegedPermissions, p) {
+			return nil, ErrImpersonatePrivileged
+		}
+	}
+
+	roles, err := im.queries.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := mappers.UserRowToModel(userRow)
+	for _, r := range roles {
+		user.Roles = append(user.Roles, models.Role{
+			ID:   uint(r.ID),
+			Name: r.Name,
+		})
+	}
+
+	token, jti, expiresAt, err := im.jwtService.GenerateImpersonationToken(&user, admin.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = im.queries.CreateImpersonation(ctx, db.CreateImpersonationParams{
+		AdminID:   sql.NullInt64{Int64: int64(admin.ID), Valid: true},
+		UserID:    userID,
+		Jti:       jti,
+		Ip:        client.IP,
+		UserAgent: truncateUserAgent(client.UserAgent),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Admin %d (%s) started impersonating user %d (%s) from %s", admin.ID, admin.Email, user.ID, user.Email, client.IP)
+
+	return &ImpersonationToken{
+		AccessToken:    token,
+		ExpiresAt:      expiresAt,
+		User:           &user,
+		ImpersonatorID: admin.ID,
+	}, nil
+}
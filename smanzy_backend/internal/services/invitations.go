@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// invitationPrefixLength is how many characters of a code are kept in plain
+// text to help admins tell codes apart
+const invitationPrefixLength = 8
+
+var (
+	// ErrInvitationNotFound is returned when an invitation does not exist
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvalidInvitation is returned when a code is unknown, expired or used up
+	ErrInvalidInvitation = errors.New("invitation code is invalid, expired or used up")
+	// ErrInvitationExpiryInPast is returned when an invitation is created with an expiry that has passed
+	ErrInvitationExpiryInPast = errors.New("invitation expiry must be in the future")
+	// ErrInvalidMaxUses is returned when max uses is given but not positive
+	ErrInvalidMaxUses = errors.New("max uses must be at least 1")
+)
+
+// Invitation describes a stored invitation; the code itself is never available again
+type Invitation struct {
+	ID        int64      `json:"id"`
+	Prefix    string     `json:"prefix"`
+	Role      *string    `json:"role"`
+	CreatedBy *int64     `json:"created_by"`
+	MaxUses   *int32     `json:"max_uses"`
+	Uses      int32      `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt int64      `json:"created_at"`
+}
+
+// CreatedInvitation is returned once, when the invitation is created
+type CreatedInvitation struct {
+	Invitation
+	Code string `json:"code"`
+}
+
+// InvitationService manages the invitation codes used when registration is
+// invite-only
+type InvitationService struct {
+	queries *db.Queries
+}
+
+// NewInvitationService creates a new invitation service
+func NewInvitationService(queries *db.Queries) *InvitationService {
+	return &InvitationService{
+		queries: queries,
+	}
+}
+
+// Create issues a new invitation code. roleName, maxUses and expiresAt are
+// optional; without maxUses the code can be used any number of times.
+func (iv *InvitationService) Create(ctx context.Context, createdBy int64, roleName string, maxUses *int32, expiresAt *time.Time) (*CreatedInvitation, error) {
+	if maxUses != nil && *maxUses < 1 {
+		return nil, ErrInvalidMaxUses
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvitationExpiryInPast
+	}
+
+	var roleID sql.NullInt64
+	if roleName != "" {
+		role, err := iv.queries.GetRoleByName(ctx, roleName)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrRoleNotFound
+			}
+			return nil, err
+		}
+		roleID = sql.NullInt64{Int64: role.ID, Valid: true}
+	}
+
+	code, codeHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	params := db.CreateInvitationParams{
+		Prefix:    code[:invitationPrefixLength],
+		CodeHash:  codeHash,
+		RoleID:    roleID,
+		CreatedBy: sql.NullInt64{Int64: createdBy, Valid: true},
+	}
+	if maxUses != nil {
+		params.MaxUses = sql.NullInt32{Int32: *maxUses, Valid: true}
+	}
+	if expiresAt != nil {
+		params.ExpiresAt = sql.NullTime{Time: *expiresAt, Valid: true}
+	}
+
+	row, err := iv.queries.CreateInvitation(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := invitationFromRow(db.ListInvitationsRow{
+		ID:        row.ID,
+		Prefix:    row.Prefix,
+		RoleID:    row.RoleID,
+		RoleName:  sql.NullString{String: roleName, Valid: roleID.Valid},
+		CreatedBy: row.CreatedBy,
+		MaxUses:   row.MaxUses,
+		Uses:      row.Uses,
+		ExpiresAt: row.ExpiresAt,
+		CreatedAt: row.CreatedAt,
+	})
+	return &CreatedInvitation{Invitation: invitation, Code: code}, nil
+}
+
+// List returns every invitation, newest first, including used up and expired ones
+func (iv *InvitationService) List(ctx context.Context) ([]Invitation, error) {
+	rows, err := iv.queries.ListInvitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := make([]Invitation, 0, len(rows))
+	for _, row := range rows {
+		invitations = append(invitations, invitationFromRow(row))
+	}
+	return invitations, nil
+}
+
+// Delete removes an invitation and returns it; its code stops working right away
+func (iv *InvitationService) Delete(ctx context.Context, id int64) (*Invitation, error) {
+	row, err := iv.queries.DeleteInvitation(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	invitation := invitationFromRow(db.ListInvitationsRow(row))
+	return &invitation, nil
+}
+
+// RedeemInvitation uses up one use of a code and returns the role it grants,
+// if any. Call it in the transaction that creates the user, so a failed
+// registration does not count as a use.
+func RedeemInvitation(ctx context.Context, queries *db.Queries, code string) (sql.NullInt64, error) {
+	row, err := queries.RedeemInvitation(ctx, auth.HashOpaqueToken(code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sql.NullInt64{}, ErrInvalidInvitation
+		}
+		return sql.NullInt64{}, err
+	}
+	return row.RoleID, nil
+}
+
+// invitationFromRow converts a database row to its API representation
+func invitationFromRow(row db.ListInvitationsRow) Invitation {
+	invitation := Invitation{
+		ID:        row.ID,
+		Prefix:    row.Prefix,
+		Uses:      row.Uses,
+		CreatedAt: row.CreatedAt,
+	}
+	if row.RoleName.Valid {
+		invitation.Role = &row.RoleName.String
+	}
+	if row.CreatedBy.Valid {
+		invitation.CreatedBy = &row.CreatedBy.Int64
+	}
+	if row.MaxUses.Valid {
+		invitation.MaxUses = &row.MaxUses.Int32
+	}
+	if row.ExpiresAt.Valid {
+		invitation.ExpiresAt = &row.ExpiresAt.Time
+	}
+	return invitation
+}
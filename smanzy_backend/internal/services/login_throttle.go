@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+const (
+	// LoginAttemptWindow is how far back failed attempts are counted
+	LoginAttemptWindow = 15 * time.Minute
+	// LoginLockoutThreshold is the number of failures after which an account is locked
+	LoginLockoutThreshold = 10
+	// LoginLockoutDuration is how long a locked account stays locked
+	LoginLockoutDuration = 15 * time.Minute
+	// LoginHistoryRetention is how long attempts stay in the login history
+	LoginHistoryRetention = 90 * 24 * time.Hour
+
+	// accountFreeFailures and ipFreeFailures are allowed before delays kick in
+	accountFreeFailures = 3
+	ipFreeFailures      = 10
+	// accountMaxDelay and ipMaxDelay cap the progressive delay
+	accountMaxDelay = 30 * time.Second
+	ipMaxDelay      = time.Minute
+)
+
+// LoginThrottledError is returned when a login attempt comes too soon after
+// earlier failures, or the account is locked
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account locked, retry after %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+// LoginThrottleService protects login against password guessing. Failed
+// attempts are tracked per account and per IP in Postgres, so limits hold
+// across IPs and across API replicas. Each failure beyond a free allowance
+// doubles the wait before the next attempt; too many failures lock the
+// account for a while. Unknown emails are tracked exactly like real accounts
+// so responses do not reveal which accounts exist.
+type LoginThrottleService struct {
+	conn    *sql.DB
+	queries *db.Queries
+}
+
+// NewLoginThrottleService creates a new login throttle service
+func NewLoginThrottleService(conn *sql.DB, queries *db.Queries) *LoginThrottleService {
+	return &LoginThrottleService{
+		conn:    conn,
+		queries: queries,
+	}
+}
+
+// NormalizeLoginEmail returns the key attempts for an email are tracked under
+func NormalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Reserve records a login attempt for email from ip before the password is
+// checked, and returns its id for RecordFailure or RecordSuccess. Until then
+// the attempt counts as a failure. Attempts on the same email or from the same
+// IP are reserved one at a time, so a burst of parallel requests cannot all
+// pass before their failures are counted. It returns a *LoginThrottledError,
+// reserving nothing, when a login must not be attempted yet.
+func (lt *LoginThrottleService) Reserve(ctx context.Context, email, ip string) (int64, error) {
+	now := time.Now()
+	email = NormalizeLoginEmail(email)
+
+	tx, err := lt.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := lt.queries.WithTx(tx)
+
+	if err := qtx.LockLoginAttempts(ctx, db.LockLoginAttemptsParams{Email: email, Ip: ip}); err != nil {
+		return 0, err
+	}
+
+	lockedUntil, err := qtx.GetLoginLockout(ctx, email)
+	if err == nil {
+		return 0, &LoginThrottledError{RetryAfter: lockedUntil.Sub(now), Locked: true}
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	since := now.Add(-LoginAttemptWindow)
+
+	account, err := qtx.GetAccountLoginFailures(ctx, db.GetAccountLoginFailuresParams{
+		Email:     email,
+		CreatedAt: since,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if wait := retryAfter(account.Failures, account.LastFailedAt, accountFreeFailures, accountMaxDelay, now); wait > 0 {
+		return 0, &LoginThrottledError{RetryAfter: wait}
+	}
+
+	byIP, err := qtx.GetIPLoginFailures(ctx, db.GetIPLoginFailuresParams{
+		Ip:        ip,
+		CreatedAt: since,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if wait := retryAfter(byIP.Failures, byIP.LastFailedAt, ipFreeFailures, ipMaxDelay, now); wait > 0 {
+		return 0, &LoginThrottledError{RetryAfter: wait}
+	}
+
+	attemptID, err := qtx.ReserveLoginAttempt(ctx, db.ReserveLoginAttemptParams{
+		Email: email,
+		Ip:    ip,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return attemptID, tx.Commit()
+}
+
+// RecordFailure records that a reserved attempt failed and locks the account
+// once it reaches LoginLockoutThreshold failures. userID is 0 for unknown
+// emails.
+func (lt *LoginThrottleService) RecordFailure(ctx context.Context, attemptID int64, email string, userID int64) error {
+	email = NormalizeLoginEmail(email)
+
+	err := lt.queries.FinishLoginAttempt(ctx, db.FinishLoginAttemptParams{
+		ID:        attemptID,
+		UserID:    sql.NullInt64{Int64: userID, Valid: userID != 0},
+		Succeeded: false,
+	})
+	if err != nil {
+		return err
+	}
+
+	account, err := lt.queries.GetAccountLoginFailures(ctx, db.GetAccountLoginFailuresParams{
+		Email:     email,
+		CreatedAt: time.Now().Add(-LoginAttemptWindow),
+	})
+	if err != nil {
+		return err
+	}
+	if account.Failures < LoginLockoutThreshold {
+		return nil
+	}
+
+	// Start over once the lockout ends, instead of relocking on the next failure
+	if err := lt.queries.ClearLoginFailures(ctx, email); err != nil {
+		return err
+	}
+	return lt.queries.UpsertLoginLockout(ctx, db.UpsertLoginLockoutParams{
+		Email:       email,
+		LockedUntil: time.Now().Add(LoginLockoutDuration),
+	})
+}
+
+// RecordSuccess records that a reserved attempt succeeded; earlier failures
+// of the account no longer count
+func (lt *LoginThrottleService) RecordSuccess(ctx context.Context, attemptID int64, email string, userID int64) error {
+	email = NormalizeLoginEmail(email)
+
+	err := lt.queries.FinishLoginAttempt(ctx, db.FinishLoginAttemptParams{
+		ID:        attemptID,
+		UserID:    sql.NullInt64{Int64: userID, Valid: true},
+		Succeeded: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	return lt.queries.ClearLoginFailures(ctx, email)
+}
+
+// Unlock lifts a lockout and forgets the failures that led to it, so the
+// account can log in right away
+func (lt *LoginThrottleService) Unlock(ctx context.Context, email string) error {
+	email = NormalizeLoginEmail(email)
+
+	if err := lt.queries.ClearLoginFailures(ctx, email); err != nil {
+		return err
+	}
+	return lt.queries.DeleteLoginLockout(ctx, email)
+}
+
+// Purge deletes attempts older than LoginHistoryRetention, attempts on
+// unknown emails once they no longer count, and lockouts that have ended
+func (lt *LoginThrottleService) Purge(ctx context.Context) (int64, error) {
+	now := time.Now()
+	attempts, err := lt.queries.DeleteOldLoginAttempts(ctx, db.DeleteOldLoginAttemptsParams{
+		HistoryCutoff: now.Add(-LoginHistoryRetention),
+		WindowCutoff:  now.Add(-LoginAttemptWindow),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old login attempts: %w", err)
+	}
+	lockouts, err := lt.queries.DeleteExpiredLoginLockouts(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired login lockouts: %w", err)
+	}
+	return attempts + lockouts, nil
+}
+
+// Run calls Purge every interval until ctx is done
+func (lt *LoginThrottleService) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, func(ctx context.Context) {
+		if _, err := lt.Purge(ctx); err != nil {
+			log.Printf("Login attempt cleanup failed: %v", err)
+		}
+	})
+}
+
+// retryAfter returns how long to wait after the last failure: nothing for
+// the first free failures, then 1s, 2s, 4s, ... up to maxDelay
+func retryAfter(failures int64, lastFailedAt time.Time, free int64, maxDelay time.Duration, now time.Time) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	delay := maxDelay
+	if shift := failures - free; shift < 16 {
+		delay = min(time.Second<<shift, maxDelay)
+	}
+
+	return lastFailedAt.Add(delay).Sub(now)
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{7, 16 * time.Second},
+		{8, 30 * time.Second},   // Capped
+		{100, 30 * time.Second}, // Capped without overflowing
+	}
+
+	for _, tt := range tests {
+		if got := retryAfter(tt.failures, now, accountFreeFailures, accountMaxDelay, now); got != tt.want {
+			t.Fatalf("%d failures: expected %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+
+	// The wait runs from the last failure
+	if got := retryAfter(4, now.Add(-5*time.Second), accountFreeFailures, accountMaxDelay, now); got > 0 {
+		t.Fatalf("expected no wait once the delay has passed, got %s", got)
+	}
+}
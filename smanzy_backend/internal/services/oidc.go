@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mappers"
+	"github.com/ristep/smanzy_backend/internal/models"
+	"github.com/ristep/smanzy_backend/internal/oidc"
+)
+
+var (
+	// ErrOIDCEmailNotVerified is returned when a new identity has no verified email to link by
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not report a verified email")
+	// ErrOIDCUserUnavailable is returned when the linked user no longer exists
+	ErrOIDCUserUnavailable = errors.New("linked user is not available")
+	// ErrOIDCRegistrationClosed is returned when a new identity would need a new
+	// account but registration is not open
+	ErrOIDCRegistrationClosed = errors.New("registration is not open")
+)
+
+// OIDCService signs users in with an external OpenID Connect provider and
+// links provider identities to local users
+type OIDCService struct {
+	conn         *sql.DB
+	queries      *db.Queries
+	provider     *oidc.Provider
+	providerName string
+}
+
+// NewOIDCService creates a new OIDC login service. providerName is stored
+// with every linked identity so several providers can coexist later.
+func NewOIDCService(conn *sql.DB, queries *db.Queries, provider *oidc.Provider, providerName string) *OIDCService {
+	return &OIDCService{
+		conn:         conn,
+		queries:      queries,
+		provider:     provider,
+		providerName: providerName,
+	}
+}
+
+// Provider returns the configured identity provider
+func (oc *OIDCService) Provider() *oidc.Provider {
+	return oc.provider
+}
+
+// ResolveUser returns the local user for verified ID token claims. Known
+// identities map to their linked user. A new identity is linked to the user
+// with the same (provider verified) email, or a new user with the default
+// "user" role is created.
+func (oc *OIDCService) ResolveUser(ctx context.Context, claims *oidc.IDTokenClaims) (*models.User, error) {
+	identity, err := oc.queries.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider: oc.providerName,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		return oc.loadUser(ctx, oc.queries, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	tx, err := oc.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := oc.queries.WithTx(tx)
+
+	var userID int64
+	existing, err := qtx.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		userID = existing.ID
+	case errors.Is(err, sql.ErrNoRows):
+		// Invitation codes cannot be passed through the provider, so only
+		// open registration creates accounts
+		mode, err := RegistrationMode(ctx, qtx)
+		if err != nil {
+			return nil, err
+		}
+		if mode != RegistrationOpen {
+			return nil, ErrOIDCRegistrationClosed
+		}
+		userID, err = oc.createUser(ctx, qtx, claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	// The provider vouches for the address
+	if err := qtx.SetUserEmailVerified(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	err = qtx.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		UserID:   userID,
+		Provider: oc.providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	user, err := oc.loadUser(ctx, qtx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// createUser creates a local account for a new identity. It has no usable
+// password; the user can set one via forgot-password.
+func (oc *OIDCService) createUser(ctx context.Context, queries *db.Queries, claims *oidc.IDTokenClaims) (int64, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	userRole, err := queries.GetRoleByName(ctx, "user")
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		userRole, err = queries.CreateRole(ctx, "user")
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	newUser, err := queries.CreateUser(ctx, db.CreateUserParams{
+		Email:    claims.Email,
+		Password: auth.UnusablePassword,
+		Name:     name,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	err = queries.AssignRole(ctx, db.AssignRoleParams{
+		UserID: newUser.ID,
+		RoleID: userRole.ID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	return newUser.ID, nil
+}
+
+// loadUser fetches a user together with their roles
+func (oc *OIDCService) loadUser(ctx context.Context, queries *db.Queries, userID int64) (*models.User, error) {
+	userRow, err := queries.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOIDCUserUnavailable
+		}
+		return nil, err
+	}
+
+	roles, err := queries.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := mappers.UserRowToModel(userRow)
+	for _, r := range roles {
+		user.Roles = append(user.Roles, models.Role{
+			ID:   uint(r.ID),
+			Name: r.Name,
+		})
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ulule/limiter/v3"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mailer"
+)
+
+// PasswordResetTTL is how long a password reset link stays valid
+const PasswordResetTTL = time.Hour
+
+// PasswordSetupTTL is how long the link in an invitation to an account
+// created by an admin stays valid
+const PasswordSetupTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidResetToken is returned for unknown, expired or already used reset tokens
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	// ErrResetRateLimited is returned when too many reset emails were requested
+	ErrResetRateLimited = errors.New("too many password reset emails requested")
+)
+
+// PasswordResetService implements the self-service forgot/reset password flow.
+// Reset tokens are opaque, single-use and stored only as SHA-256 hashes.
+type PasswordResetService struct {
+	conn           *sql.DB
+	queries        *db.Queries
+	mailer         mailer.Mailer
+	appBaseURL     string
+	sessionService *SessionService
+	passwordHasher *auth.PasswordHasher
+	requestLimiter *limiter.Limiter
+}
+
+// NewPasswordResetService creates a new password reset service. Reset
+// requests are counted in limitStore, which all replicas should share.
+func NewPasswordResetService(conn *sql.DB, queries *db.Queries, m mailer.Mailer, appBaseURL string, sessionService *SessionService, passwordHasher *auth.PasswordHasher, limitStore limiter.Store) *PasswordResetService {
+	return &PasswordResetService{
+		conn:           conn,
+		queries:        queries,
+		mailer:         m,
+		appBaseURL:     strings.TrimRight(appBaseURL, "/"),
+		sessionService: sessionService,
+		passwordHasher: passwordHasher,
+		// At most 3 reset emails per address per hour
+		requestLimiter: limiter.New(limitStore, limiter.Rate{Period: time.Hour, Limit: 3}),
+	}
+}
+
+// RequestReset emails a reset link to the account with the given address.
+// The account is looked up and the email sent in the background, and unknown
+// addresses are silently ignored, so neither the result nor the time taken
+// reveals which addresses have an account. Failures are only logged.
+func (ps *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	limit, err := ps.requestLimiter.Get(ctx, "reset:"+strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+	if limit.Reached {
+		return ErrResetRateLimited
+	}
+
+	runDetached(ctx, "send password reset email", func(ctx context.Context) error {
+		return ps.sendReset(ctx, email)
+	})
+	return nil
+}
+
+// sendReset emails a reset link if the address belongs to an account
+func (ps *PasswordResetService) sendReset(ctx context.Context, email string) error {
+	userRow, err := ps.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	link, err := ps.newResetLink(ctx, userRow.ID, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return ps.mailer.Send(ctx, mailer.Message{
+		To:      userRow.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %d minutes. If you did not request a reset, you can ignore this email.\n",
+			userRow.Name, link, int(PasswordResetTTL.Minutes())),
+	})
+}
+
+// SendInvitation emails a user whose account was created by an admin a link
+// to choose their password. The link works like a reset link but stays valid
+// for PasswordSetupTTL.
+func (ps *PasswordResetService) SendInvitation(ctx context.Context, userID int64, email, name string) error {
+	link, err := ps.newResetLink(ctx, userID, PasswordSetupTTL)
+	if err != nil {
+		return err
+	}
+
+	return ps.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "You have been invited to Smanzy",
+		Body: fmt.Sprintf("Hello %s,\n\nAn account has been created for you. Open the link below to choose your password:\n\n%s\n\nThe link expires in %d days. After that, use \"Forgot password\" on the login page to get a new one.\n",
+			name, link, int(PasswordSetupTTL.Hours()/24)),
+	})
+}
+
+// newResetLink stores a new reset token for the user, invalidating older
+// ones, and returns the frontend link that redeems it
+func (ps *PasswordResetService) newResetLink(ctx context.Context, userID int64, ttl time.Duration) (string, error) {
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Only the most recent link is valid
+	if err := ps.queries.InvalidateUserPasswordResetTokens(ctx, userID); err != nil {
+		return "", err
+	}
+
+	err = ps.queries.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	return fmt.Sprintf("%s/reset-password?token=%s", ps.appBaseURL, url.QueryEscape(token)), nil
+}
+
+// ResetPassword consumes a reset token, sets the new password and revokes
+// every existing session of the user. A password rejected by the policy
+// leaves the token unused so the user can try again.
+func (ps *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	tx, err := ps.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := ps.queries.WithTx(tx)
+
+	userID, err := qtx.ConsumePasswordResetToken(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	userRow, err := qtx.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if err := auth.ValidatePassword(newPassword, userRow.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := ps.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = qtx.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		ID:       userID,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := ps.sessionService.RevokeAllSessionsTx(ctx, qtx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
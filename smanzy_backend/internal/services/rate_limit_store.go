@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/common"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// PostgresRateLimitStore is a limiter.Store that keeps fixed-window request
+// counters in Postgres, so all API replicas count against the same limits.
+// Windows follow the database clock, which the replicas share.
+type PostgresRateLimitStore struct {
+	queries *db.Queries
+}
+
+var _ limiter.Store = (*PostgresRateLimitStore)(nil)
+
+// NewPostgresRateLimitStore creates a new Postgres rate limit store
+func NewPostgresRateLimitStore(queries *db.Queries) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{
+		queries: queries,
+	}
+}
+
+// Get counts one request for key and returns the resulting limit state
+func (rs *PostgresRateLimitStore) Get(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return rs.Increment(ctx, key, 1, rate)
+}
+
+// Increment counts count requests for key and returns the resulting limit state
+func (rs *PostgresRateLimitStore) Increment(ctx context.Context, key string, count int64, rate limiter.Rate) (limiter.Context, error) {
+	row, err := rs.queries.IncrementRateLimitCounter(ctx, db.IncrementRateLimitCounterParams{
+		Key:      key,
+		Count:    count,
+		PeriodMs: rate.Period.Milliseconds(),
+	})
+	if err != nil {
+		return limiter.Context{}, err
+	}
+	return common.GetContextFromState(time.Now(), rate, row.ExpiresAt, row.Count), nil
+}
+
+// Peek returns the limit state for key without counting a request
+func (rs *PostgresRateLimitStore) Peek(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	now := time.Now()
+	row, err := rs.queries.GetRateLimitCounter(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return common.GetContextFromState(now, rate, now.Add(rate.Period), 0), nil
+	}
+	if err != nil {
+		return limiter.Context{}, err
+	}
+	return common.GetContextFromState(now, rate, row.ExpiresAt, row.Count), nil
+}
+
+// Reset forgets the requests counted for key
+func (rs *PostgresRateLimitStore) Reset(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	if err := rs.queries.DeleteRateLimitCounter(ctx, key); err != nil {
+		return limiter.Context{}, err
+	}
+	now := time.Now()
+	return common.GetContextFromState(now, rate, now.Add(rate.Period), 0), nil
+}
+
+// Run deletes expired counters every interval until ctx is done
+func (rs *PostgresRateLimitStore) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, func(ctx context.Context) {
+		if _, err := rs.queries.DeleteExpiredRateLimitCounters(ctx); err != nil {
+			log.Printf("Failed to delete expired rate limit counters: %v", err)
+		}
+	})
+}
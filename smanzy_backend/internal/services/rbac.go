@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// SeedRBAC makes sure every known permission and the built-in roles exist,
+// and grants the built-in roles their default permissions. Grants are only
+// ever added, so it is safe to run on every startup.
+func SeedRBAC(ctx context.Context, queries *db.Queries) error {
+	names := make([]string, 0, len(auth.PermissionDescriptions))
+	for name := range auth.PermissionDescriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := queries.UpsertPermission(ctx, db.UpsertPermissionParams{
+			Name:        name,
+			Description: auth.PermissionDescriptions[name],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to seed permission %s: %w", name, err)
+		}
+	}
+
+	grants := map[string][]string{
+		auth.RoleUser:  auth.DefaultRolePermissions[auth.RoleUser],
+		auth.RoleAdmin: names,
+	}
+	for _, role := range auth.BuiltInRoles {
+		if _, err := queries.CreateRole(ctx, role); err != nil {
+			return fmt.Errorf("failed to seed role %s: %w", role, err)
+		}
+		for _, permission := range grants[role] {
+			err := queries.GrantRolePermission(ctx, db.GrantRolePermissionParams{
+				RoleName:       role,
+				PermissionName: permission,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to grant %s to %s: %w", permission, role, err)
+			}
+		}
+	}
+
+	return nil
+}
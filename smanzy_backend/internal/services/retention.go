@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// DefaultRetentionPeriod is how long soft-deleted users, albums and media
+// are kept (and can be restored) before they are purged for good
+const DefaultRetentionPeriod = 30 * 24 * time.Hour
+
+// thumbnailDirPattern matches the per-size thumbnail directories (e.g.
+// 320x200) that the thumbnail generator creates in the upload directory
+var thumbnailDirPattern = regexp.MustCompile(`^\d+x\d+$`)
+
+// PurgeReport summarises one retention run
+type PurgeReport struct {
+	Users        int
+	Albums       int64
+	Media        int // Including the media of purged users
+	FilesRemoved int // Originals and thumbnails
+	FileErrors   int
+}
+
+// Empty reports whether the run purged nothing
+func (r PurgeReport) Empty() bool {
+	return r.Users == 0 && r.Albums == 0 && r.Media == 0 && r.FilesRemoved == 0 && r.FileErrors == 0
+}
+
+func (r PurgeReport) String() string {
+	return fmt.Sprintf("%d user(s), %d album(s), %d media, %d file(s) removed, %d file error(s)",
+		r.Users, r.Albums, r.Media, r.FilesRemoved, r.FileErrors)
+}
+
+// RetentionService permanently deletes users, albums and media that were
+// soft deleted longer than the retention period ago, along with their files
+type RetentionService struct {
+	conn      *sql.DB
+	queries   *db.Queries
+	uploadDir string
+	retention time.Duration
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService(conn *sql.DB, queries *db.Queries, uploadDir string, retention time.Duration) *RetentionService {
+	return &RetentionService{
+		conn:      conn,
+		queries:   queries,
+		uploadDir: uploadDir,
+		retention: retention,
+	}
+}
+
+// Purge deletes expired rows, then their files. Rows go first, so a failure
+// can at worst leave unreferenced files behind. The report covers what was
+// purged before an error.
+func (rt *RetentionService) Purge(ctx context.Context) (PurgeReport, error) {
+	var report PurgeReport
+	cutoff := time.Now().Add(-rt.retention)
+
+	userIDs, err := rt.queries.ListPurgeableUsers(ctx, cutoff)
+	if err != nil {
+		return report, fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, userID := range userIDs {
+		storedNames, err := rt.purgeUser(ctx, userID)
+		if err != nil {
+			return report, fmt.Errorf("failed to purge user %d: %w", userID, err)
+		}
+		if storedNames == nil {
+			continue // Restored in the meantime
+		}
+		report.Users++
+		report.Media += len(storedNames)
+		rt.removeMediaFiles(storedNames, &report)
+	}
+
+	albums, err := rt.queries.PurgeDeletedAlbums(ctx, cutoff)
+	if err != nil {
+		return report, fmt.Errorf("failed to purge albums: %w", err)
+	}
+	report.Albums = albums
+
+	media, err := rt.queries.PurgeDeletedMedia(ctx, cutoff)
+	if err != nil {
+		return report, fmt.Errorf("failed to purge media: %w", err)
+	}
+	storedNames := make([]string, 0, len(media))
+	for _, m := range media {
+		storedNames = append(storedNames, m.StoredName)
+	}
+	report.Media += len(media)
+	rt.removeMediaFiles(storedNames, &report)
+
+	return report, nil
+}
+
+// Run calls Purge every interval until ctx is done
+func (rt *RetentionService) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, func(ctx context.Context) {
+		report, err := rt.Purge(ctx)
+		if err != nil {
+			log.Printf("Retention purge failed after %s: %v", report, err)
+			return
+		}
+		if !report.Empty() {
+			log.Printf("Retention purge: %s", report)
+		}
+	})
+}
+
+// purgeUser deletes a soft-deleted user and, through ON DELETE CASCADE,
+// everything they own. It returns the stored names of the user's media, or
+// nil when the user is no longer deleted.
+func (rt *RetentionService) purgeUser(ctx context.Context, userID int64) ([]string, error) {
+	tx, err := rt.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := rt.queries.WithTx(tx)
+
+	storedNames, err := qtx.ListUserStoredNames(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := qtx.PermanentlyDeleteUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if storedNames == nil {
+		storedNames = []string{}
+	}
+	return storedNames, nil
+}
+
+// removeMediaFiles removes the original files and every thumbnail variant
+func (rt *RetentionService) removeMediaFiles(storedNames []string, report *PurgeReport) {
+	if len(storedNames) == 0 {
+		return
+	}
+
+	thumbDirs, err := rt.thumbnailDirs()
+	if err != nil {
+		log.Printf("Retention purge: failed to list thumbnail directories: %v", err)
+		report.FileErrors++
+	}
+
+	for _, storedName := range storedNames {
+		// Stored names are generated by the server, but never leave the upload directory
+		storedName = filepath.Base(storedName)
+		paths := []string{filepath.Join(rt.uploadDir, storedName)}
+
+		// Thumbnails are always JPEG, named after the original
+		thumbName := strings.TrimSuffix(storedName, filepath.Ext(storedName)) + ".jpg"
+		for _, dir := range thumbDirs {
+			paths = append(paths, filepath.Join(rt.uploadDir, dir, thumbName))
+		}
+
+		for _, path := range paths {
+			err := os.Remove(path)
+			switch {
+			case err == nil:
+				report.FilesRemoved++
+			case errors.Is(err, fs.ErrNotExist):
+				// Never generated or already gone
+			default:
+				log.Printf("Retention purge: failed to remove %s: %v", path, err)
+				report.FileErrors++
+			}
+		}
+	}
+}
+
+// thumbnailDirs lists the thumbnail size directories in the upload directory
+func (rt *RetentionService) thumbnailDirs() ([]string, error) {
+	dir := rt.uploadDir
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && thumbnailDirPattern.MatchString(entry.Name()) {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs, nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveMediaFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"1_100.png",
+		"320x200/1_100.jpg",
+		"800x600/1_100.jpg",
+		"800x600/1_200.jpg", // Another media's thumbnail
+		"backup/1_100.jpg",  // Not a thumbnail directory
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rt := &RetentionService{uploadDir: dir}
+	var report PurgeReport
+	rt.removeMediaFiles([]string{"1_100.png", "../1_300.png"}, &report)
+
+	if report.FilesRemoved != 3 || report.FileErrors != 0 {
+		t.Fatalf("expected 3 files removed and no errors, got %+v", report)
+	}
+	for _, f := range []string{"1_100.png", "320x200/1_100.jpg", "800x600/1_100.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed", f)
+		}
+	}
+	for _, f := range []string{"800x600/1_200.jpg", "backup/1_100.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("expected %s to be kept: %v", f, err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mappers"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+var (
+	// ErrRoleNotFound is returned when a role does not exist
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleExists is returned when a role with the requested name already exists
+	ErrRoleExists = errors.New("role already exists")
+	// ErrRoleBuiltIn is returned when renaming or deleting a built-in role
+	ErrRoleBuiltIn = errors.New("built-in roles cannot be renamed or deleted")
+	// ErrRoleHasMembers is returned when deleting a role that still has members without cascade
+	ErrRoleHasMembers = errors.New("role has members")
+	// ErrBuiltInPermissionsFixed is returned when changing a built-in role's permissions
+	ErrBuiltInPermissionsFixed = errors.New("built-in roles keep their default permissions; create a custom role instead")
+	// ErrUnknownPermission is returned when granting a permission that does not exist
+	ErrUnknownPermission = errors.New("unknown permission")
+	// ErrInvalidRoleName is returned when a role name does not match roleNamePattern
+	ErrInvalidRoleName = errors.New("role names must be 2-50 lowercase letters, digits, '-' or '_', starting with a letter")
+)
+
+// roleNamePattern keeps role names usable in URLs and logs
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// RoleService manages roles and the permissions granted to them
+type RoleService struct {
+	conn    *sql.DB
+	queries *db.Queries
+}
+
+// NewRoleService creates a new role service
+func NewRoleService(conn *sql.DB, queries *db.Queries) *RoleService {
+	return &RoleService{
+		conn:    conn,
+		queries: queries,
+	}
+}
+
+// List returns every role with its permissions and member count
+func (rs *RoleService) List(ctx context.Context) ([]models.RoleSummary, error) {
+	rows, err := rs.queries.ListRoleSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]models.RoleSummary, 0, len(rows))
+	for _, row := range rows {
+		roles = append(roles, mappers.RoleSummaryRowToModel(row))
+	}
+	return roles, nil
+}
+
+// Get returns a single role
+func (rs *RoleService) Get(ctx context.Context, roleID int64) (*models.RoleSummary, error) {
+	return rs.get(ctx, rs.queries, roleID)
+}
+
+// Create adds a role granted the given permissions
+func (rs *RoleService) Create(ctx context.Context, name string, permissions []string) (*models.RoleSummary, error) {
+	name = strings.TrimSpace(name)
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrInvalidRoleName
+	}
+	if err := validatePermissions(permissions); err != nil {
+		return nil, err
+	}
+
+	tx, err := rs.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := rs.queries.WithTx(tx)
+
+	if err := ensureRoleNameFree(ctx, qtx, name); err != nil {
+		return nil, err
+	}
+
+	role, err := qtx.CreateRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := grantPermissions(ctx, qtx, name, permissions); err != nil {
+		return nil, err
+	}
+
+	summary, err := rs.get(ctx, qtx, role.ID)
+	if err != nil {
+		return nil, err
+	}
+	return summary, tx.Commit()
+}
+
+// Update renames a role and/or replaces its permissions. A nil name or
+// permissions leaves that part unchanged.
+func (rs *RoleService) Update(ctx context.Context, roleID int64, name *string, permissions []string) (*models.RoleSummary, error) {
+	if permissions != nil {
+		if err := validatePermissions(permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := rs.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := rs.queries.WithTx(tx)
+
+	role, err := rs.get(ctx, qtx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil && strings.TrimSpace(*name) != role.Name {
+		newName := strings.TrimSpace(*name)
+		if role.BuiltIn {
+			return nil, ErrRoleBuiltIn
+		}
+		if !roleNamePattern.MatchString(newName) {
+			return nil, ErrInvalidRoleName
+		}
+		if err := ensureRoleNameFree(ctx, qtx, newName); err != nil {
+			return nil, err
+		}
+		if err := qtx.RenameRole(ctx, db.RenameRoleParams{ID: roleID, Name: newName}); err != nil {
+			return nil, err
+		}
+		role.Name = newName
+	}
+
+	if permissions != nil {
+		// Startup seeding would grant them back anyway
+		if role.BuiltIn {
+			return nil, ErrBuiltInPermissionsFixed
+		}
+		if err := qtx.ClearRolePermissions(ctx, roleID); err != nil {
+			return nil, err
+		}
+		if err := grantPermissions(ctx, qtx, role.Name, permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	summary, err := rs.get(ctx, qtx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	return summary, tx.Commit()
+}
+
+// Delete removes a role. A role that still has members is only deleted
+// when cascade is set, which also removes it from those users.
+func (rs *RoleService) Delete(ctx context.Context, roleID int64, cascade bool) error {
+	tx, err := rs.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := rs.queries.WithTx(tx)
+
+	role, err := rs.get(ctx, qtx, roleID)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return ErrRoleBuiltIn
+	}
+
+	members, err := qtx.CountRoleMembers(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if members > 0 && !cascade {
+		return fmt.Errorf("%w: %d user(s)", ErrRoleHasMembers, members)
+	}
+
+	// user_roles and role_permissions rows go with it (ON DELETE CASCADE)
+	if err := qtx.DeleteRole(ctx, roleID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListUsers returns the role's members, including soft-deleted users
+func (rs *RoleService) ListUsers(ctx context.Context, roleID int64) ([]models.User, error) {
+	if _, err := rs.get(ctx, rs.queries, roleID); err != nil {
+		return nil, err
+	}
+
+	rows, err := rs.queries.ListRoleUsers(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]models.User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, mappers.UserRowToModel(row))
+	}
+	return users, nil
+}
+
+// get loads a role summary, mapping a missing role to ErrRoleNotFound
+func (rs *RoleService) get(ctx context.Context, q *db.Queries, roleID int64) (*models.RoleSummary, error) {
+	row, err := q.GetRoleSummary(ctx, roleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	role := mappers.RoleSummaryRowToModel(row)
+	return &role, nil
+}
+
+// ensureRoleNameFree returns ErrRoleExists when a role is already called name
+func ensureRoleNameFree(ctx context.Context, q *db.Queries, name string) error {
+	_, err := q.GetRoleByName(ctx, name)
+	if err == nil {
+		return ErrRoleExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// validatePermissions rejects permission names that do not exist
+func validatePermissions(permissions []string) error {
+	for _, p := range permissions {
+		if _, ok := auth.PermissionDescriptions[p]; !ok {
+			return fmt.Errorf("%w %q", ErrUnknownPermission, p)
+		}
+	}
+	return nil
+}
+
+// grantPermissions grants the permissions to the role called roleName
+func grantPermissions(ctx context.Context, q *db.Queries, roleName string, permissions []string) error {
+	for _, p := range slices.Compact(slices.Sorted(slices.Values(permissions))) {
+		err := q.GrantRolePermission(ctx, db.GrantRolePermissionParams{
+			RoleName:       roleName,
+			PermissionName: p,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
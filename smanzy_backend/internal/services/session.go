@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/mappers"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or malformed
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrSessionNotFound is returned when a session does not exist, has ended or belongs to someone else
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// maxUserAgentLength caps the stored User-Agent header
+const maxUserAgentLength = 512
+
+// SessionHistoryRetention is how long ended sessions stay in the login history
+const SessionHistoryRetention = 90 * 24 * time.Hour
+
+// SessionClient describes the client a session is used from
+type SessionClient struct {
+	IP        string
+	UserAgent string
+}
+
+// SessionService issues token pairs and rotates refresh tokens.
+// Every refresh token is stored by jti; each login starts a new token family
+// and every rotation stays in that family, so reuse of an old token can
+// revoke the whole chain.
+type SessionService struct {
+	conn       *sql.DB
+	queries    *db.Queries
+	jwtService *auth.JWTService
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(conn *sql.DB, queries *db.Queries, jwtService *auth.JWTService) *SessionService {
+	return &SessionService{
+		conn:       conn,
+		queries:    queries,
+		jwtService: jwtService,
+	}
+}
+
+// IssueTokenPair starts a new session (token family) for the user. mfa marks
+// sessions established with a second factor; it is kept across rotations.
+func (ss *SessionService) IssueTokenPair(ctx context.Context, user *models.User, mfa bool, client SessionClient) (*auth.TokenPair, error) {
+	familyID, err := auth.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ss.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := ss.queries.WithTx(tx)
+
+	tokenPair, err := ss.issueInFamily(ctx, qtx, user, familyID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	err = qtx.CreateUserSession(ctx, db.CreateUserSessionParams{
+		FamilyID:  familyID,
+		UserID:    int64(user.ID),
+		Ip:        client.IP,
+		UserAgent: truncateUserAgent(client.UserAgent),
+		ExpiresAt: tokenPair.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+
+	// Signing in during the grace period cancels a requested account deletion
+	if err := qtx.CancelUserDeletion(ctx, int64(user.ID)); err != nil {
+		return nil, fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return tokenPair, nil
+}
+
+// RotateRefreshToken exchanges a valid refresh token for a new token pair in
+// the same family. Presenting a token that was already rotated or revoked
+// revokes the entire family.
+func (ss *SessionService) RotateRefreshToken(ctx context.Context, refreshToken string, client SessionClient) (*auth.TokenPair, error) {
+	claims, err := ss.jwtService.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tx, err := ss.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := ss.queries.WithTx(tx)
+
+	stored, err := qtx.ConsumeRefreshToken(ctx, claims.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, ss.handleUnusableToken(ctx, claims.ID)
+	}
+
+	userRow, err := qtx.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	roles, err := qtx.GetUserRoles(ctx, userRow.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := mappers.UserRowToModel(userRow)
+	for _, r := range roles {
+		user.Roles = append(user.Roles, models.Role{
+			ID:   uint(r.ID),
+			Name: r.Name,
+		})
+	}
+
+	tokenPair, err := ss.issueInFamily(ctx, qtx, &user, stored.FamilyID, claims.MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions started before session tracking have no row; nothing to update then
+	err = qtx.TouchUserSession(ctx, db.TouchUserSessionParams{
+		FamilyID:  stored.FamilyID,
+		Ip:        client.IP,
+		UserAgent: truncateUserAgent(client.UserAgent),
+		ExpiresAt: tokenPair.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return tokenPair, nil
+}
+
+// Logout ends the session the given access token belongs to: the access
+// token is denylisted until it expires and its refresh token family is revoked
+func (ss *SessionService) Logout(ctx context.Context, claims *auth.CustomClaims) error {
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		err := ss.queries.RevokeAccessToken(ctx, db.RevokeAccessTokenParams{
+			Jti:       claims.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke access token: %w", err)
+		}
+	}
+
+	if claims.FamilyID != "" {
+		if err := ss.revokeFamily(ctx, claims.FamilyID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (ss *SessionService) ListSessions(ctx context.Context, userID int64) ([]db.UserSession, error) {
+	return ss.queries.ListActiveUserSessions(ctx, userID)
+}
+
+// RevokeSession ends one of the user's sessions. Its refresh tokens stop
+// working and its access tokens are rejected by AuthMiddleware right away.
+func (ss *SessionService) RevokeSession(ctx context.Context, userID int64, familyID string) error {
+	revoked, err := ss.queries.RevokeUserSession(ctx, db.RevokeUserSessionParams{
+		FamilyID: familyID,
+		UserID:   userID,
+	})
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrSessionNotFound
+	}
+
+	if err := ss.queries.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllSessions invalidates every token issued to the user by bumping
+// their token version and revoking all of their refresh tokens. API keys do
+// not carry the token version, so they are deleted as well.
+func (ss *SessionService) RevokeAllSessions(ctx context.Context, userID int64) error {
+	tx, err := ss.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ss.RevokeAllSessionsTx(ctx, ss.queries.WithTx(tx), userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeAllSessionsTx is RevokeAllSessions within the caller's transaction,
+// so the sessions end exactly when the change that requires it commits
+func (ss *SessionService) RevokeAllSessionsTx(ctx context.Context, qtx *db.Queries, userID int64) error {
+	if _, err := qtx.IncrementUserTokenVersion(ctx, userID); err != nil {
+		return fmt.Errorf("failed to bump token version: %w", err)
+	}
+
+	if err := qtx.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := qtx.RevokeAllUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if err := qtx.DeleteAllUserAPIKeys(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete API keys: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes refresh tokens and access token revocations that have
+// expired, and sessions that ended more than SessionHistoryRetention ago.
+// An expired token is rejected on its own, so its row is no longer needed.
+func (ss *SessionService) PurgeExpired(ctx context.Context) (int64, error) {
+	refreshTokens, err := ss.queries.DeleteExpiredRefreshTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	revocations, err := ss.queries.DeleteExpiredRevokedAccessTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired access token revocations: %w", err)
+	}
+	sessions, err := ss.queries.DeleteEndedUserSessions(ctx, time.Now().Add(-SessionHistoryRetention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete ended sessions: %w", err)
+	}
+	return refreshTokens + revocations + sessions, nil
+}
+
+// Run calls PurgeExpired every interval until ctx is done
+func (ss *SessionService) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, func(ctx context.Context) {
+		if _, err := ss.PurgeExpired(ctx); err != nil {
+			log.Printf("Session cleanup failed: %v", err)
+		}
+	})
+}
+
+// handleUnusableToken decides why a refresh token could not be consumed.
+// A known token that was already revoked means it has been replayed, so the
+// whole family is revoked outside the rotation transaction.
+func (ss *SessionService) handleUnusableToken(ctx context.Context, jti string) error {
+	stored, err := ss.queries.GetRefreshToken(ctx, jti)
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+
+	if !stored.RevokedAt.Valid {
+		// Known but expired
+		return ErrInvalidRefreshToken
+	}
+
+	if err := ss.revokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// revokeFamily revokes every refresh token of a family and ends its session
+func (ss *SessionService) revokeFamily(ctx context.Context, familyID string) error {
+	if err := ss.queries.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+	if err := ss.queries.RevokeSession(ctx, familyID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// issueInFamily mints a token pair and records the refresh token
+func (ss *SessionService) issueInFamily(ctx context.Context, queries *db.Queries, user *models.User, familyID string, mfa bool) (*auth.TokenPair, error) {
+	tokenPair, err := ss.jwtService.GenerateTokenPair(user, familyID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	err = queries.CreateRefreshToken(ctx, db.CreateRefreshTokenParams{
+		Jti:       tokenPair.RefreshTokenID,
+		FamilyID:  familyID,
+		UserID:    int64(user.ID),
+		ExpiresAt: tokenPair.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return tokenPair, nil
+}
+
+// truncateUserAgent keeps stored User-Agent headers at a sane length and
+// valid UTF-8, which Postgres requires for text. It never cuts a character
+// in half.
+func truncateUserAgent(userAgent string) string {
+	userAgent = strings.ToValidUTF8(userAgent, "\uFFFD")
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+	end := maxUserAgentLength
+	for end > 0 && !utf8.RuneStart(userAgent[end]) {
+		end--
+	}
+	return userAgent[:end]
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+func TestTruncateUserAgent(t *testing.T) {
+	if got := truncateUserAgent("Mozilla/5.0"); got != "Mozilla/5.0" {
+		t.Fatalf("expected short user agent to be kept, got %q", got)
+	}
+
+	// A multi-byte character straddling the limit is dropped, not split
+	long := strings.Repeat("a", maxUserAgentLength-1) + "é"
+	got := truncateUserAgent(long)
+	if !utf8.ValidString(got) || len(got) != maxUserAgentLength-1 {
+		t.Fatalf("expected truncation on a character boundary, got %d bytes, valid %v", len(got), utf8.ValidString(got))
+	}
+
+	if got := truncateUserAgent("agent\xff"); !utf8.ValidString(got) {
+		t.Fatalf("expected invalid UTF-8 to be replaced, got %q", got)
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	ss, store := newTestSessionService(t)
+	ctx := context.Background()
+	client := SessionClient{IP: "203.0.113.7", UserAgent: "test"}
+
+	first, err := ss.IssueTokenPair(ctx, testSessionUser(), false, client)
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+	familyID := store.tokens[first.RefreshTokenID].FamilyID
+
+	second, err := ss.RotateRefreshToken(ctx, first.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("expected rotation to succeed, got %v", err)
+	}
+	if second.RefreshTokenID == first.RefreshTokenID || store.tokens[second.RefreshTokenID].FamilyID != familyID {
+		t.Fatalf("expected a new refresh token in the same family")
+	}
+	if !store.tokens[first.RefreshTokenID].RevokedAt.Valid {
+		t.Fatalf("expected rotation to consume the old token")
+	}
+
+	// Replaying the rotated token revokes the whole family and its session
+	if _, err := ss.RotateRefreshToken(ctx, first.RefreshToken, client); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if !store.tokens[second.RefreshTokenID].RevokedAt.Valid || !store.revokedSessions[familyID] {
+		t.Fatalf("expected replay to revoke the family")
+	}
+	if _, err := ss.RotateRefreshToken(ctx, second.RefreshToken, client); err == nil {
+		t.Fatalf("expected the replacement token to stop working")
+	}
+}
+
+func TestRotateRefreshToken_Expired(t *testing.T) {
+	ss, store := newTestSessionService(t)
+	ctx := context.Background()
+	client := SessionClient{IP: "203.0.113.7", UserAgent: "test"}
+
+	pair, err := ss.IssueTokenPair(ctx, testSessionUser(), false, client)
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+	stored := store.tokens[pair.RefreshTokenID]
+	stored.ExpiresAt = time.Now().Add(-time.Minute)
+
+	// An expired token is just invalid, not a replay
+	if _, err := ss.RotateRefreshToken(ctx, pair.RefreshToken, client); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken, got %v", err)
+	}
+	if stored.RevokedAt.Valid || store.revokedSessions[stored.FamilyID] {
+		t.Fatalf("expected an expired token not to revoke its family")
+	}
+}
+
+func testSessionUser() *models.User {
+	return &models.User{
+		ID:    42,
+		Email: "user@example.com",
+		Name:  "Test User",
+		Roles: []models.Role{{ID: 1, Name: "user"}},
+	}
+}
+
+func newTestSessionService(t *testing.T) (*SessionService, *fakeSessionStore) {
+	store := &fakeSessionStore{
+		tokens:          make(map[string]*db.RefreshToken),
+		revokedSessions: make(map[string]bool),
+	}
+	conn := newFakeDB(t, store.handle)
+
+	return NewSessionService(conn, db.New(conn), auth.NewJWTService("test-secret")), store
+}
+
+// fakeSessionStore keeps refresh tokens in memory and answers the queries
+// made while issuing and rotating tokens
+type fakeSessionStore struct {
+	nextID          int64
+	tokens          map[string]*db.RefreshToken
+	revokedSessions map[string]bool
+}
+
+func (s *fakeSessionStore) handle(name string, args []driver.Value) (*fakeRows, error) {
+	rows := &fakeRows{}
+	switch name {
+	case "CreateRefreshToken":
+		s.nextID++
+		s.tokens[args[0].(string)] = &db.RefreshToken{
+			ID:        s.nextID,
+			Jti:       args[0].(string),
+			FamilyID:  args[1].(string),
+			UserID:    args[2].(int64),
+			ExpiresAt: args[3].(time.Time),
+		}
+	case "RevokeRefreshTokenFamily":
+		for _, token := range s.tokens {
+			if token.FamilyID == args[0].(string) && !token.RevokedAt.Valid {
+				token.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			}
+		}
+	case "RevokeSession":
+		s.revokedSessions[args[0].(string)] = true
+	case "CreateUserSession", "CancelUserDeletion", "TouchUserSession":
+	case "ConsumeRefreshToken":
+		token := s.tokens[args[0].(string)]
+		if token != nil && !token.RevokedAt.Valid && token.ExpiresAt.After(time.Now()) {
+			token.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			rows.add(refreshTokenValues(token)...)
+		}
+	case "GetRefreshToken":
+		if token := s.tokens[args[0].(string)]; token != nil {
+			rows.add(refreshTokenValues(token)...)
+		}
+	case "GetUserByID":
+		user := testSessionUser()
+		rows.add(args[0], user.Email, "", user.Name, "", int64(0), "", "", "", "", true, int64(0), int64(0), nil, int64(0))
+	case "GetUserRoles":
+		rows.add(int64(1), "user", int64(0), int64(0))
+	default:
+		return nil, fmt.Errorf("unexpected query %s", name)
+	}
+	return rows, nil
+}
+
+func refreshTokenValues(token *db.RefreshToken) []driver.Value {
+	var revokedAt driver.Value
+	if token.RevokedAt.Valid {
+		revokedAt = token.RevokedAt.Time
+	}
+	return []driver.Value{token.ID, token.Jti, token.FamilyID, token.UserID, token.ExpiresAt, revokedAt, token.CreatedAt}
+}
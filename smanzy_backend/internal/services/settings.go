@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// Setting keys with server-side behavior attached
+const (
+	// SettingUnverifiedUserAccess controls what users with an unverified email may do
+	SettingUnverifiedUserAccess = "unverified-user-access"
+	// SettingRequireAdmin2FA ("true"/"false") requires admins to sign in with 2FA
+	SettingRequireAdmin2FA = "require-admin-2fa"
+	// SettingRegistrationMode controls who may create an account
+	SettingRegistrationMode = "registration-mode"
+)
+
+// Values for SettingUnverifiedUserAccess
+const (
+	UnverifiedAccessFull     = "full"      // No restrictions (default)
+	UnverifiedAccessNoUpload = "no-upload" // May log in but not upload media
+	UnverifiedAccessNoLogin  = "no-login"  // May not log in at all
+)
+
+// Values for SettingRegistrationMode
+const (
+	RegistrationOpen       = "open"        // Anyone may register (default)
+	RegistrationInviteOnly = "invite-only" // Registration requires an invitation code
+	RegistrationClosed     = "closed"      // Nobody may register
+)
+
+// settingAllowedValues lists the accepted values of settings that are
+// interpreted by the server. Other keys accept any value.
+var settingAllowedValues = map[string][]string{
+	SettingUnverifiedUserAccess: {UnverifiedAccessFull, UnverifiedAccessNoUpload, UnverifiedAccessNoLogin},
+	SettingRequireAdmin2FA:      {"true", "false"},
+	SettingRegistrationMode:     {RegistrationOpen, RegistrationInviteOnly, RegistrationClosed},
+}
+
+// ValidateSetting checks that the value is acceptable for a known setting key
+func ValidateSetting(key, value string) error {
+	allowed, known := settingAllowedValues[key]
+	if !known {
+		return nil
+	}
+
+	for _, v := range allowed {
+		if v == value {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid value for %s, expected one of %v", key, allowed)
+}
+
+// GetSettingOrDefault returns the stored value of a setting, or def when it is not set
+func GetSettingOrDefault(ctx context.Context, queries *db.Queries, key, def string) (string, error) {
+	value, err := queries.GetSetting(ctx, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return def, nil
+		}
+		return "", err
+	}
+
+	return value, nil
+}
+
+// RegistrationMode returns the current value of SettingRegistrationMode
+func RegistrationMode(ctx context.Context, queries *db.Queries) (string, error) {
+	return GetSettingOrDefault(ctx, queries, SettingRegistrationMode, RegistrationOpen)
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulule/limiter/v3"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+	"github.com/ristep/smanzy_backend/internal/models"
+)
+
+const (
+	// TwoFactorChallengeTTL is how long a login challenge may be exchanged for tokens
+	TwoFactorChallengeTTL = 5 * time.Minute
+	// TwoFactorIssuer is the account issuer shown in authenticator apps
+	TwoFactorIssuer = "Smanzy"
+	// RecoveryCodeCount is how many recovery codes are issued on enrollment
+	RecoveryCodeCount = 10
+)
+
+var (
+	// ErrTwoFactorAlreadyEnabled is returned when enrolling an account that already has 2FA
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnrolled is returned when there is no (pending) enrollment to act on
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	// ErrInvalidTwoFactorCode is returned for wrong, reused or expired codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorRateLimited is returned after too many failed code attempts
+	ErrTwoFactorRateLimited = errors.New("too many two-factor attempts")
+)
+
+// TwoFactorEnrollment is returned when a user starts TOTP enrollment. The
+// secret and recovery codes are shown once and never stored in plain text
+// (the secret is needed server-side to verify codes).
+type TwoFactorEnrollment struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"provisioning_uri"`
+	RecoveryCodes   []string `json:"recovery_codes"`
+}
+
+// TwoFactorService manages TOTP enrollment and verification of second factors
+type TwoFactorService struct {
+	conn           *sql.DB
+	queries        *db.Queries
+	attemptLimiter *limiter.Limiter
+}
+
+// NewTwoFactorService creates a new two-factor service. Attempts are counted
+// in limitStore, which must be shared by all replicas for the limit to hold.
+func NewTwoFactorService(conn *sql.DB, queries *db.Queries, limitStore limiter.Store) *TwoFactorService {
+	return &TwoFactorService{
+		conn:    conn,
+		queries: queries,
+		// At most 5 code attempts per user per 5 minutes
+		attemptLimiter: limiter.New(limitStore, limiter.Rate{Period: 5 * time.Minute, Limit: 5}),
+	}
+}
+
+// IsEnabled reports whether the user has confirmed TOTP enrollment
+func (ts *TwoFactorService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	totp, err := ts.queries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return totp.EnabledAt.Valid, nil
+}
+
+// RemainingRecoveryCodes returns how many unused recovery codes the user has
+func (ts *TwoFactorService) RemainingRecoveryCodes(ctx context.Context, userID int64) (int64, error) {
+	return ts.queries.CountUnusedRecoveryCodes(ctx, userID)
+}
+
+// BeginEnrollment creates a new (disabled) TOTP secret and a fresh set of
+// recovery codes. 2FA only becomes active once ConfirmEnrollment succeeds.
+func (ts *TwoFactorService) BeginEnrollment(ctx context.Context, user *models.User) (*TwoFactorEnrollment, error) {
+	enabled, err := ts.IsEnabled(ctx, int64(user.ID))
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := auth.NewRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ts.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := ts.queries.WithTx(tx)
+
+	err = qtx.UpsertUserTOTP(ctx, db.UpsertUserTOTPParams{
+		UserID: int64(user.ID),
+		Secret: secret,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	}
+
+	if err := qtx.DeleteUserRecoveryCodes(ctx, int64(user.ID)); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		err = qtx.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+			UserID:   int64(user.ID),
+			CodeHash: auth.HashOpaqueToken(auth.NormalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(TwoFactorIssuer, user.Email, secret),
+		RecoveryCodes:   codes,
+	}, nil
+}
+
+// ConfirmEnrollment activates a pending enrollment after checking a code
+// from the authenticator app
+func (ts *TwoFactorService) ConfirmEnrollment(ctx context.Context, userID int64, code string) error {
+	totp, err := ts.queries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTwoFactorNotEnrolled
+		}
+		return err
+	}
+	if totp.EnabledAt.Valid {
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := ts.verifyTOTP(ctx, totp, code); err != nil {
+		return err
+	}
+
+	return ts.queries.EnableUserTOTP(ctx, userID)
+}
+
+// Verify checks a second factor for a user with 2FA enabled. The code may be
+// a current TOTP code or an unused recovery code; either is accepted once.
+// Each attempt is counted before the code is checked, so parallel requests
+// cannot get past the limit; a correct code starts the count over.
+func (ts *TwoFactorService) Verify(ctx context.Context, userID int64, code string) error {
+	key := "2fa:" + strconv.FormatInt(userID, 10)
+	limit, err := ts.attemptLimiter.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if limit.Reached {
+		return ErrTwoFactorRateLimited
+	}
+
+	if err := ts.verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	if _, err := ts.attemptLimiter.Reset(ctx, key); err != nil {
+		log.Printf("Failed to reset two-factor attempts of user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// Disable removes the user's TOTP secret and recovery codes
+func (ts *TwoFactorService) Disable(ctx context.Context, userID int64) error {
+	tx, err := ts.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := ts.queries.WithTx(tx)
+
+	if err := qtx.DeleteUserTOTP(ctx, userID); err != nil {
+		return err
+	}
+	if err := qtx.DeleteUserRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RequiresTwoFactor reports whether the site settings require the user to
+// authenticate with a second factor. Currently that is the case for users
+// with a privileged permission (admins) when require-admin-2fa is enabled.
+func RequiresTwoFactor(ctx context.Context, queries *db.Queries, user *models.User) (bool, error) {
+	privileged := false
+	for _, permission := range auth.PrivilegedPermissions {
+		if user.HasPermission(permission) {
+			privileged = true
+			break
+		}
+	}
+	if !privileged {
+		return false, nil
+	}
+
+	value, err := GetSettingOrDefault(ctx, queries, SettingRequireAdmin2FA, "false")
+	if err != nil {
+		return false, err
+	}
+
+	return value == "true", nil
+}
+
+// verify checks a code without applying the attempt limit
+func (ts *TwoFactorService) verify(ctx context.Context, userID int64, code string) error {
+	totp, err := ts.queries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTwoFactorNotEnrolled
+		}
+		return err
+	}
+	if !totp.EnabledAt.Valid {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == auth.TOTPDigits {
+		return ts.verifyTOTP(ctx, totp, code)
+	}
+
+	used, err := ts.queries.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: auth.HashOpaqueToken(auth.NormalizeRecoveryCode(code)),
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// verifyTOTP validates a TOTP code and records its time step so the same
+// code cannot be used twice
+func (ts *TwoFactorService) verifyTOTP(ctx context.Context, totp db.UserTotp, code string) error {
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	updated, err := ts.queries.SetUserTOTPLastUsedStep(ctx, db.SetUserTOTPLastUsedStepParams{
+		UserID:       totp.UserID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		// Step already used (replay) or older than the last accepted code
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
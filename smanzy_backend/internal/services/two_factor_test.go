@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+func TestTwoFactorVerify_ConcurrentAttemptsLimited(t *testing.T) {
+	checked := 0
+	conn := newFakeDB(t, func(name string, args []driver.Value) (*fakeRows, error) {
+		rows := &fakeRows{}
+		switch name {
+		case "GetUserTOTP":
+			rows.add(args[0], "JBSWY3DPEHPK3PXP", time.Now(), int64(0), int64(0))
+		case "UseRecoveryCode":
+			// No recovery code matches
+			checked++
+		default:
+			return nil, fmt.Errorf("unexpected query %s", name)
+		}
+		return rows, nil
+	})
+	ts := NewTwoFactorService(conn, db.New(conn), memory.NewStore())
+
+	const attempts = 20
+	results := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- ts.Verify(context.Background(), 7, "wrong-recovery-code")
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	invalid, limited := 0, 0
+	for err := range results {
+		switch {
+		case errors.Is(err, ErrInvalidTwoFactorCode):
+			invalid++
+		case errors.Is(err, ErrTwoFactorRateLimited):
+			limited++
+		default:
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if invalid != 5 || limited != attempts-5 || checked != 5 {
+		t.Fatalf("expected 5 codes checked and the rest rate limited, got %d invalid, %d limited, %d checked", invalid, limited, checked)
+	}
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ristep/smanzy_backend/internal/auth"
+	"github.com/ristep/smanzy_backend/internal/db"
+)
+
+// MaxImportRows is the largest number of users a single CSV import may create
+const MaxImportRows = 500
+
+// exportPageSize is how many users are read per query while exporting
+const exportPageSize = 500
+
+// ErrInvalidImportFile is returned when an import file cannot be read as a
+// whole, as opposed to rows that fail validation
+var ErrInvalidImportFile = errors.New("invalid import file")
+
+// importColumns are the columns an import file may have; email and name are required
+var importColumns = []string{"email", "name", "tel", "city", "country", "roles"}
+
+// exportColumns are the columns of an exported file
+var exportColumns = []string{"id", "email", "name", "tel", "city", "country", "roles", "email_verified", "created_at", "deleted_at"}
+
+// ImportRow is one user read from an import file
+type ImportRow struct {
+	Line    int      `json:"line"`
+	Email   string   `json:"email"`
+	Name    string   `json:"name"`
+	Tel     string   `json:"tel"`
+	City    string   `json:"city"`
+	Country string   `json:"country"`
+	Roles   []string `json:"roles"`
+}
+
+// ImportRowError describes why a row of an import file was rejected
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ImportedUser is a user created by an import
+type ImportedUser struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// UserCSVService imports users from and exports them to CSV files
+type UserCSVService struct {
+	conn         *sql.DB
+	queries      *db.Queries
+	resetService *PasswordResetService
+}
+
+// NewUserCSVService creates a new user CSV service
+func NewUserCSVService(conn *sql.DB, queries *db.Queries, resetService *PasswordResetService) *UserCSVService {
+	return &UserCSVService{
+		conn:         conn,
+		queries:      queries,
+		resetService: resetService,
+	}
+}
+
+// ParseImport reads an import file. The first line is a header naming the
+// columns, in any order; unknown columns are rejected so that typos do not
+// silently drop data. Roles are separated by semicolons or spaces.
+func (uc *UserCSVService) ParseImport(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: file is empty", ErrInvalidImportFile)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(importColumns, name) {
+			return nil, fmt.Errorf("%w: unknown column %q, expected %s", ErrInvalidImportFile, name, strings.Join(importColumns, ", "))
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidImportFile, name)
+		}
+		index[name] = i
+	}
+	for _, required := range []string{"email", "name"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("%w: missing required column %q", ErrInvalidImportFile, required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := index[name]; ok {
+			return unescapeCSVFormula(strings.TrimSpace(record[i]))
+		}
+		return ""
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidImportFile, MaxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, ImportRow{
+			Line:    line,
+			Email:   field(record, "email"),
+			Name:    field(record, "name"),
+			Tel:     field(record, "tel"),
+			City:    field(record, "city"),
+			Country: field(record, "country"),
+			Roles: strings.FieldsFunc(field(record, "roles"), func(r rune) bool {
+				return r == ';' || r == ' '
+			}),
+		})
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: no rows after the header", ErrInvalidImportFile)
+	}
+	return rows, nil
+}
+
+// Validate checks every row and returns all problems found; the import may
+// only run when there are none
+func (uc *UserCSVService) Validate(ctx context.Context, rows []ImportRow) ([]ImportRowError, error) {
+	problems := []ImportRowError{}
+	seen := make(map[string]int, len(rows))
+	knownRoles := make(map[string]bool)
+
+	for _, row := range rows {
+		fail := func(field, message string) {
+			problems = append(problems, ImportRowError{Line: row.Line, Field: field, Error: message})
+		}
+
+		email := strings.ToLower(row.Email)
+		switch addr, err := mail.ParseAddress(row.Email); {
+		case row.Email == "":
+			fail("email", "Email is required")
+		case err != nil || addr.Address != row.Email:
+			fail("email", "Invalid email address")
+		case seen[email] != 0:
+			fail("email", fmt.Sprintf("Duplicate of line %d", seen[email]))
+		default:
+			seen[email] = row.Line
+			_, err := uc.queries.GetUserByEmailWithDeleted(ctx, row.Email)
+			if err == nil {
+				fail("email", "A user with this email already exists")
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+		}
+
+		if utf8.RuneCountInString(row.Name) < 2 {
+			fail("name", "Name must be at least 2 characters")
+		}
+
+		for _, roleName := range row.Roles {
+			exists, ok := knownRoles[roleName]
+			if !ok {
+				_, err := uc.queries.GetRoleByName(ctx, roleName)
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return nil, err
+				}
+				exists = err == nil
+				knownRoles[roleName] = exists
+			}
+			if !exists {
+				fail("roles", fmt.Sprintf("Role %q does not exist", roleName))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// Import creates the users of validated rows in a single transaction, so
+// either all of them are created or none is. Imported users have no usable
+// password; they choose their own through an invitation or password reset
+// email.
+func (uc *UserCSVService) Import(ctx context.Context, rows []ImportRow) ([]ImportedUser, error) {
+	tx, err := uc.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	qtx := uc.queries.WithTx(tx)
+
+	// Every user gets the default role, like on registration
+	defaultRole, err := qtx.GetRoleByName(ctx, "user")
+	if errors.Is(err, sql.ErrNoRows) {
+		defaultRole, err = qtx.CreateRole(ctx, "user")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDs := map[string]int64{defaultRole.Name: defaultRole.ID}
+	users := make([]ImportedUser, 0, len(rows))
+
+	for _, row := range rows {
+		userRow, err := qtx.CreateUser(ctx, db.CreateUserParams{
+			Email:    row.Email,
+			Password: auth.UnusablePassword,
+			Name:     row.Name,
+			Tel:      sql.NullString{String: row.Tel, Valid: row.Tel != ""},
+			City:     sql.NullString{String: row.City, Valid: row.City != ""},
+			Country:  sql.NullString{String: row.Country, Valid: row.Country != ""},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to create user: %w", row.Line, err)
+		}
+
+		assigned := make(map[int64]bool)
+		for _, roleName := range append([]string{defaultRole.Name}, row.Roles...) {
+			roleID, ok := roleIDs[roleName]
+			if !ok {
+				role, err := qtx.GetRoleByName(ctx, roleName)
+				if err != nil {
+					if errors.Is(err, sql.ErrNoRows) {
+						return nil, fmt.Errorf("line %d: %w", row.Line, ErrRoleNotFound)
+					}
+					return nil, err
+				}
+				roleID = role.ID
+				roleIDs[roleName] = roleID
+			}
+			if assigned[roleID] {
+				continue
+			}
+			assigned[roleID] = true
+
+			err := qtx.AssignRole(ctx, db.AssignRoleParams{
+				UserID: userRow.ID,
+				RoleID: roleID,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("line %d: failed to assign role: %w", row.Line, err)
+			}
+		}
+
+		users = append(users, ImportedUser{ID: userRow.ID, Email: userRow.Email, Name: userRow.Name})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SendInvitations emails each imported user a link to choose their
+// password. Delivery failures are logged and counted, not returned: the
+// users exist either way and can use "Forgot password" later.
+func (uc *UserCSVService) SendInvitations(ctx context.Context, users []ImportedUser) (sent, failed int) {
+	for _, user := range users {
+		if err := uc.resetService.SendInvitation(ctx, user.ID, user.Email, user.Name); err != nil {
+			log.Printf("Failed to send invitation email to %s: %v", user.Email, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	return sent, failed
+}
+
+// WriteCSV writes every user matching the filters as CSV. Limit and Offset
+// of params are ignored; users are read a page at a time.
+func (uc *UserCSVService) WriteCSV(ctx context.Context, params db.SearchUsersParams, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+
+	params.Limit = exportPageSize
+	params.Offset = 0
+	for {
+		rows, err := uc.queries.SearchUsers(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			var roles []struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(row.Roles, &roles); err != nil {
+				return err
+			}
+			roleNames := make([]string, 0, len(roles))
+			for _, role := range roles {
+				roleNames = append(roleNames, role.Name)
+			}
+
+			deletedAt := ""
+			if row.DeletedAt.Valid {
+				deletedAt = row.DeletedAt.Time.UTC().Format(time.RFC3339)
+			}
+
+			record := []string{
+				strconv.FormatInt(row.ID, 10),
+				row.Email,
+				row.Name,
+				row.Tel,
+				row.City,
+				row.Country,
+				strings.Join(roleNames, ";"),
+				strconv.FormatBool(row.EmailVerified),
+				time.UnixMilli(row.CreatedAt).UTC().Format(time.RFC3339),
+				deletedAt,
+			}
+			for i := range record {
+				record[i] = escapeCSVFormula(record[i])
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		if len(rows) < exportPageSize {
+			return nil
+		}
+		params.Offset += exportPageSize
+	}
+}
+
+// escapeCSVFormula keeps spreadsheet applications from evaluating user
+// supplied values such as "=HYPERLINK(...)" as formulas
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVFormula undoes escapeCSVFormula, so exported files can be
+// imported again unchanged
+func unescapeCSVFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
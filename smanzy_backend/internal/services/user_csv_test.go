@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseImport(t *testing.T) {
+	uc := &UserCSVService{}
+
+	input := "\ufeffName, Email,roles\n" +
+		"Ana Petrova, ana@example.com, editor;moderator\n" +
+		"\"Smith, John\",john@example.com,\n"
+	rows, err := uc.ParseImport(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("expected file to parse, got %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Line != 2 || rows[0].Email != "ana@example.com" || rows[0].Name != "Ana Petrova" ||
+		!slices.Equal(rows[0].Roles, []string{"editor", "moderator"}) {
+		t.Fatalf("unexpected first row: %+v", rows[0])
+	}
+	if rows[1].Line != 3 || rows[1].Name != "Smith, John" || len(rows[1].Roles) != 0 {
+		t.Fatalf("unexpected second row: %+v", rows[1])
+	}
+
+	tooMany := "email,name\n" + strings.Repeat("a@example.com,Ana\n", MaxImportRows+1)
+	for _, input := range []string{"", "email\n", "email,name,password\n", "email,name,email\n", "email,name\n", tooMany} {
+		if _, err := uc.ParseImport(strings.NewReader(input)); !errors.Is(err, ErrInvalidImportFile) {
+			t.Fatalf("expected ErrInvalidImportFile for %.40q, got %v", input, err)
+		}
+	}
+}
+
+func TestEscapeCSVFormula(t *testing.T) {
+	cases := map[string]string{
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+38970123456":      "'+38970123456",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"Skopje":            "Skopje",
+		"":                  "",
+	}
+	for in, want := range cases {
+		if got := escapeCSVFormula(in); got != want {
+			t.Fatalf("escapeCSVFormula(%q) = %q, want %q", in, got, want)
+		}
+		if got := unescapeCSVFormula(want); got != in {
+			t.Fatalf("unescapeCSVFormula(%q) = %q, want %q", want, got, in)
+		}
+	}
+
+	if got := unescapeCSVFormula("'quoted"); got != "'quoted" {
+		t.Fatalf("expected apostrophe before plain text to be kept, got %q", got)
+	}
+}
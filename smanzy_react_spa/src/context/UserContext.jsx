@@ -1,5 +1,5 @@
 import { createContext, useContext, useState, useEffect } from 'react';
-import api from '@/services/api';
+import api, { cookieAuth } from '@/services/api';
 
 const UserContext = createContext(null);
 
@@ -9,7 +9,8 @@ export const UserProvider = ({ children }) => {
 
     useEffect(() => {
         const storedUser = localStorage.getItem('user');
-        const token = localStorage.getItem('token');
+        // In cookie mode the token is an HttpOnly cookie the page cannot see
+        const token = cookieAuth || localStorage.getItem('token');
 
         if (token && storedUser) {
             try {
@@ -25,13 +26,23 @@ export const UserProvider = ({ children }) => {
     const login = (userData, token, refreshToken) => {
         setUser(userData);
         localStorage.setItem('user', JSON.stringify(userData));
-        localStorage.setItem('token', token);
+        if (token) {
+            localStorage.setItem('token', token);
+        }
         if (refreshToken) {
             localStorage.setItem('refresh_token', refreshToken);
         }
     };
 
-    const logout = () => {
+    const logout = async () => {
+        if (cookieAuth) {
+            // Only the backend can clear the HttpOnly session cookies
+            try {
+                await api.post('/auth/logout');
+            } catch (error) {
+                console.error("Failed to log out", error);
+            }
+        }
         setUser(null);
         localStorage.removeItem('user');
         localStorage.removeItem('token');
@@ -2,7 +2,7 @@ import { useState } from "react";
 import { useNavigate, Link } from "react-router-dom";
 import { useMutation } from "@tanstack/react-query";
 import { Mail, Lock, Loader2, LogIn, Eye, EyeOff } from "lucide-react";
-import api from "@/services/api";
+import api, { cookieAuth } from "@/services/api";
 import Button from "@/components/Button";
 
 import styles from "./index.module.scss";
@@ -20,7 +20,7 @@ export default function Login() {
         mutationFn: (data) => api.post("/auth/login", data),
         onSuccess: (data) => {
             const token = data.data?.data?.access_token || data.data?.access_token;
-            if (token) {
+            if (token || cookieAuth) {
                 login(data.data?.data?.user, token, data.data?.data?.refresh_token);
             }
             navigate("/profile");
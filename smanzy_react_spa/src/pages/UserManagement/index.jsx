@@ -44,13 +44,13 @@ export default function UserManagement() {
         return null;
     }
 
-    // Fetch users (with or without deleted)
+    // Fetch one page of users (with or without deleted)
     const { isPending, error, data } = useQuery({
-        queryKey: ['users', showDeleted],
-        queryFn: () => {
-            const endpoint = showDeleted ? '/users/deleted' : '/users';
-            return api.get(endpoint).then((res) => res.data);
-        },
+        queryKey: ['users', showDeleted, page],
+        queryFn: () =>
+            api
+                .get('/users', { params: { state: showDeleted ? 'all' : 'active', page, limit } })
+                .then((res) => res.data),
         enabled: isAdmin,
         retry: false,
     });
@@ -225,20 +225,15 @@ export default function UserManagement() {
         );
     }
 
-    const users = data?.data || [];
-    const totalUsers = users.length;
+    const users = data?.data?.users || [];
+    const totalUsers = data?.data?.pagination?.total || 0;
+    const totalPages = data?.data?.pagination?.total_pages || 0;
 
     // Derived state
     const editingUser = users.find((u) => u.id === editingUserId);
     const resetPasswordUser = users.find((u) => u.id === resetPasswordUserId);
     const managingRolesUser = users.find((u) => u.id === managingRolesUserId);
 
-    // Client-side pagination
-    const startIndex = (page - 1) * limit;
-    const endIndex = startIndex + limit;
-    const paginatedUsers = users.slice(startIndex, endIndex);
-    const totalPages = Math.ceil(totalUsers / limit);
-
     const handlePageChange = (newPage) => {
         setSearchParams({ page: newPage });
         window.scrollTo({ top: 0, behavior: 'smooth' });
@@ -264,7 +259,7 @@ export default function UserManagement() {
                             {showDeleted ? 'All Users (Including Deleted)' : 'Active Users'}
                         </h2>
                         <p className={styles.tableInfo}>
-                            Showing {paginatedUsers.length} of {totalUsers} users
+                            Showing {users.length} of {totalUsers} users
                         </p>
                     </div>
                     {totalPages > 1 && (
@@ -274,7 +269,10 @@ export default function UserManagement() {
                     )}
                     <div className={styles.headerActions}>
                         <Button
-                            onClick={() => setShowDeleted(!showDeleted)}
+                            onClick={() => {
+                                setShowDeleted(!showDeleted);
+                                setSearchParams({ page: 1 });
+                            }}
                             variant={showDeleted ? 'primary' : 'secondary'}
                             size="sm"
                         >
@@ -283,7 +281,7 @@ export default function UserManagement() {
                     </div>
                 </div>
 
-                {paginatedUsers.length === 0 ? (
+                {users.length === 0 ? (
                     <div className={styles.emptyState}>
                         <div className={styles.emptyIcon}>👥</div>
                         <p className={styles.emptyText}>No users found</p>
@@ -301,7 +299,7 @@ export default function UserManagement() {
                                 </tr>
                             </thead>
                             <tbody className={styles.tbody}>
-                                {paginatedUsers.map((user) => {
+                                {users.map((user) => {
                                     const deleted = isUserDeleted(user);
                                     return (
                                         <tr key={user.id} className={clsx(styles.tr, deleted && styles.deletedRow)}>
@@ -379,7 +377,7 @@ export default function UserManagement() {
                 )}
 
                 {/* Pagination */}
-                {paginatedUsers.length > 0 && totalPages > 1 && (
+                {users.length > 0 && totalPages > 1 && (
                     <div className={styles.pagination}>
                         <div className={styles.paginationInfo}>
                             Page <span>{page}</span> of <span>{totalPages}</span>
@@ -1,14 +1,32 @@
 import axios from 'axios';
 
+// Cookie mode: the backend keeps the tokens in HttpOnly cookies (AUTH_COOKIES=true)
+// and state-changing requests echo the CSRF token in the X-CSRF-Token header
+export const cookieAuth = import.meta.env.VITE_AUTH_COOKIES === 'true';
+
 const api = axios.create({
     baseURL: import.meta.env.VITE_API_BASE_URL || 'http://localhost:8080/api',
     headers: {
         'Content-Type': 'application/json',
     },
+    withCredentials: cookieAuth,
 });
 
+// CSRF token of the cookie session, kept in memory only
+let csrfToken = null;
+
+const csrfSafeMethods = ['get', 'head', 'options'];
+
+const fetchCsrfToken = async () => {
+    const res = await api.get('/auth/csrf');
+    csrfToken = res.data.data.csrf_token;
+    return csrfToken;
+};
+
 let isRefreshing = false;
 let failedQueue = [];
+// In cookie mode concurrent 401s share one refresh request
+let refreshPromise = null;
 
 const processQueue = (error, token = null) => {
     failedQueue.forEach((prom) => {
@@ -22,8 +40,15 @@ const processQueue = (error, token = null) => {
     failedQueue = [];
 };
 
-// Request interceptor to add token
-api.interceptors.request.use((config) => {
+// Request interceptor to add token (or the CSRF token in cookie mode)
+api.interceptors.request.use(async (config) => {
+    if (cookieAuth) {
+        if (!csrfSafeMethods.includes((config.method || 'get').toLowerCase())) {
+            config.headers['X-CSRF-Token'] = csrfToken || (await fetchCsrfToken());
+        }
+        return config;
+    }
+
     const token = localStorage.getItem('token');
     if (token) {
         config.headers.Authorization = `Bearer ${token}`;
@@ -33,11 +58,36 @@ api.interceptors.request.use((config) => {
 
 // Response interceptor to handle errors (e.g. 401)
 api.interceptors.response.use(
-    (response) => response,
+    (response) => {
+        // Logins and refreshes in cookie mode hand out the CSRF token
+        const newCsrfToken = cookieAuth && response.data?.data?.csrf_token;
+        if (newCsrfToken) {
+            csrfToken = newCsrfToken;
+        }
+        return response;
+    },
     async (error) => {
         const originalRequest = error.config;
 
-        if (error.response?.status === 401 && !originalRequest._retry) {
+        if (cookieAuth && error.response?.status === 401 && !originalRequest._retry && originalRequest.url !== '/auth/refresh') {
+            // The refresh token cookie is sent along automatically
+            originalRequest._retry = true;
+            try {
+                if (!refreshPromise) {
+                    refreshPromise = api.post('/auth/refresh').finally(() => {
+                        refreshPromise = null;
+                    });
+                }
+                await refreshPromise;
+                return api(originalRequest);
+            } catch (refreshError) {
+                localStorage.clear();
+                window.location.href = '/login';
+                return Promise.reject(refreshError);
+            }
+        }
+
+        if (!cookieAuth && error.response?.status === 401 && !originalRequest._retry) {
             if (isRefreshing) {
                 return new Promise(function (resolve, reject) {
                     failedQueue.push({ resolve, reject });